@@ -6,4 +6,4 @@ toolchain go1.24.4
 
 require golang.org/x/exp v0.0.0-20250819193227-8b4c13bb791b
 
-require github.com/twmb/murmur3 v1.1.8 // indirect
+require github.com/twmb/murmur3 v1.1.8
@@ -1,11 +1,20 @@
 package bloomfilter
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"github.com/twmb/murmur3"
 	"hash/fnv"
+	"io"
 	"math"
+	"math/bits"
+	"sync"
+	"unsafe"
 )
 
+var ErrIncompatibleFilters = errors.New("bloomfilter: filters have different parameters")
+
 type Server interface {
 	LoadData() []string
 	Contains(value string) bool
@@ -14,6 +23,37 @@ type Server interface {
 
 type hashFunction func(h1, h2 uint32) uint32
 
+// HashingScheme selects how the k bit positions are derived from the two base
+// hashes.
+type HashingScheme uint32
+
+const (
+	// DoubleHashing uses h1 + i*h2 + i*i.
+	DoubleHashing HashingScheme = iota
+	// EnhancedDoubleHashing uses the Dillinger-Manolios variant
+	// h1 + i*h2 + (i^3-i)/6 over a prime number of bits, so no h2 can share a
+	// factor with numBits and collapse the positions into a short cycle.
+	EnhancedDoubleHashing
+)
+
+// Hasher produces the two base hashes from which every bit position of a key
+// is derived. Hash must not modify key or retain it after returning: string
+// keys are passed without copying and may alias immutable memory.
+type Hasher interface {
+	Hash(key []byte) (h1, h2 uint32)
+}
+
+// murmurFNVHasher is the default Hasher: seeded murmur3 and fnv-1a.
+type murmurFNVHasher struct {
+	seed uint32
+}
+
+func (h murmurFNVHasher) Hash(key []byte) (uint32, uint32) {
+	f := fnv.New32a()
+	_, _ = f.Write(key)
+	return murmur3.SeedSum32(h.seed, key), f.Sum32()
+}
+
 type BloomFilter struct {
 	bitsArray        []byte
 	hashFunctions    []hashFunction
@@ -21,29 +61,240 @@ type BloomFilter struct {
 	maxSize          uint32
 	numHashFunctions uint32
 	seed             uint32
-	count            uint32
+	hasher           Hasher
+	scheme           HashingScheme
+	// count is the number of inserts, an upper bound on the distinct keys
+	// held: repeated keys and keys shared with a Union source count again.
+	// It saturates at MaxUint32 instead of wrapping.
+	count      uint32
+	concurrent bool
+	mu         sync.RWMutex
 }
 
 func NewBloomFilter(n uint32, fpRate float64, seed uint32) *BloomFilter {
+	numBits, k := optimalParameters(n, fpRate)
+
+	byteLen := (numBits + 7) / 8
+	bf := &BloomFilter{
+		maxSize:          n,
+		seed:             seed,
+		hasher:           murmurFNVHasher{seed: seed},
+		numBits:          numBits,
+		bitsArray:        make([]byte, byteLen),
+		numHashFunctions: k,
+	}
+	bf.hashFunctions = initHashFunctions(k, numBits)
+	return bf
+}
+
+// NewBloomFilterWithScheme sizes a filter like NewBloomFilter and derives the
+// positions with scheme. EnhancedDoubleHashing rounds numBits up to a prime.
+func NewBloomFilterWithScheme(n uint32, fpRate float64, seed uint32, scheme HashingScheme) *BloomFilter {
+	bf := NewBloomFilter(n, fpRate, seed)
+	if scheme == EnhancedDoubleHashing {
+		bf.numBits = nextPrime(bf.numBits)
+		bf.bitsArray = make([]byte, (bf.numBits+7)/8)
+	}
+	bf.scheme = scheme
+	bf.hashFunctions = scheme.hashFunctions(bf.numHashFunctions, bf.numBits)
+	return bf
+}
+
+// NewBloomFilterWithHasher sizes a filter like NewBloomFilter but derives bit
+// positions from hasher. Union, Intersect and Equals assume that compatible
+// filters use the same hasher; the seed of such a filter is zero.
+func NewBloomFilterWithHasher(n uint32, fpRate float64, hasher Hasher) *BloomFilter {
+	bf := NewBloomFilter(n, fpRate, 0)
+	bf.hasher = hasher
+	return bf
+}
+
+// NewConcurrentBloomFilter returns a filter whose methods are safe for
+// concurrent use: writers take an exclusive lock and readers a shared one.
+// Union, Intersect, Equals and the intersection estimates lock one filter at a
+// time, so they may be called with concurrent filters in any order.
+// Filters from NewBloomFilter skip the locking entirely.
+func NewConcurrentBloomFilter(n uint32, fpRate float64, seed uint32) *BloomFilter {
+	bf := NewBloomFilter(n, fpRate, seed)
+	bf.concurrent = true
+	return bf
+}
+
+// optimalParameters returns the number of bits and hash functions for n keys
+// at the target false-positive rate.
+func optimalParameters(n uint32, fpRate float64) (numBits, k uint32) {
 	if fpRate <= 0 || fpRate >= 1 {
 		panic("fpRate must be in (0,1)")
 	}
 	ln2 := math.Ln2
-	numBits := uint32(math.Ceil(float64(n) * math.Abs(math.Log(fpRate)) / (ln2 * ln2)))
-	k := uint32(math.Max(1, math.Round((float64(numBits)/float64(n))*ln2)))
+	numBits = uint32(math.Ceil(float64(n) * math.Abs(math.Log(fpRate)) / (ln2 * ln2)))
+	k = uint32(math.Max(1, math.Round((float64(numBits)/float64(n))*ln2)))
+	return numBits, k
+}
+
+func NewBloomFilterFromBits(bits []byte, k, seed uint32) *BloomFilter {
+	if len(bits) == 0 {
+		panic("bits must not be empty")
+	}
+	if k == 0 {
+		panic("k must be positive")
+	}
+	if len(bits) > math.MaxUint32/8 {
+		panic("bits must hold at most MaxUint32 bits")
+	}
+	numBits := uint32(len(bits)) * 8
 
-	byteLen := (numBits + 7) / 8
 	bf := &BloomFilter{
-		maxSize:          n,
 		seed:             seed,
+		hasher:           murmurFNVHasher{seed: seed},
 		numBits:          numBits,
-		bitsArray:        make([]byte, byteLen),
+		bitsArray:        make([]byte, len(bits)),
 		numHashFunctions: k,
 	}
+	copy(bf.bitsArray, bits)
 	bf.hashFunctions = initHashFunctions(k, numBits)
 	return bf
 }
 
+func BuildBloomFilterWithReport(keys []string, fpRate float64, seed uint32) (bf *BloomFilter, collisions int) {
+	n := uint32(len(keys))
+	if n == 0 {
+		n = 1
+	}
+	bf = NewBloomFilter(n, fpRate, seed)
+	for _, key := range keys {
+		if bf.Contains(key) {
+			collisions++
+		}
+		bf.Insert(key)
+	}
+	return bf, collisions
+}
+
+// IntersectionCount estimates |A ∩ B| as |A| + |B| - |A ∪ B|, with each
+// cardinality derived from set-bit counts. a and b must share parameters. It
+// is the two-filter case of IntersectionCount3.
+func IntersectionCount(a, b *BloomFilter) (uint32, error) {
+	if !a.compatible(b) {
+		return 0, ErrIncompatibleFilters
+	}
+	est := a.estimateFromSetBits(a.setBitCount()) +
+		a.estimateFromSetBits(b.setBitCount()) -
+		a.estimateFromSetBits(orSetBitCount(a, b))
+	return clampEstimate(est), nil
+}
+
+// IntersectionCount3 estimates |A ∩ B ∩ C| by inclusion-exclusion over the
+// single, pairwise and triple unions. All filters must share parameters.
+func IntersectionCount3(a, b, c *BloomFilter) (uint32, error) {
+	if !a.compatible(b) || !a.compatible(c) {
+		return 0, ErrIncompatibleFilters
+	}
+	n := a.estimateFromSetBits
+	est := n(a.setBitCount()) + n(b.setBitCount()) + n(c.setBitCount()) -
+		n(orSetBitCount(a, b)) - n(orSetBitCount(a, c)) - n(orSetBitCount(b, c)) +
+		n(orSetBitCount(a, b, c))
+	return clampEstimate(est), nil
+}
+
+// Union ORs other into b, so b reports every key inserted into either filter.
+// Both filters must share numBits, the number of hash functions and the seed.
+// The insert counts are added, so keys present in both are counted twice.
+func (b *BloomFilter) Union(other *BloomFilter) error {
+	if !b.compatible(other) {
+		return ErrIncompatibleFilters
+	}
+	bits, count := other.snapshot()
+	b.lock()
+	defer b.unlock()
+	for i, v := range bits {
+		b.bitsArray[i] |= v
+	}
+	b.addCount(count)
+	return nil
+}
+
+// Intersect ANDs other into b. The result keeps every key inserted into both
+// filters, but bits set by different keys in each source can line up, so it
+// has a higher false-positive rate than a filter built from the true
+// intersection and may report keys that were in neither set.
+func (b *BloomFilter) Intersect(other *BloomFilter) error {
+	if !b.compatible(other) {
+		return ErrIncompatibleFilters
+	}
+	bits, count := other.snapshot()
+	b.lock()
+	defer b.unlock()
+	for i, v := range bits {
+		b.bitsArray[i] &= v
+	}
+	b.count = min(b.count, count)
+	return nil
+}
+
+// Equals reports whether both filters share parameters and every bit. Bits
+// past numBits in the last byte are never written by Insert; a filter with any
+// of them set is treated as corrupt and never equal. Like Union, it compares b
+// against a snapshot of other taken under other's own read lock.
+func (b *BloomFilter) Equals(other *BloomFilter) bool {
+	if !b.compatible(other) {
+		return false
+	}
+	bits, _ := other.snapshot()
+	b.rlock()
+	defer b.runlock()
+	if len(b.bitsArray) != len(bits) {
+		return false
+	}
+	if hasStrayBits(b.bitsArray, b.numBits) || hasStrayBits(bits, b.numBits) {
+		return false
+	}
+	return bytes.Equal(b.bitsArray, bits)
+}
+
+func hasStrayBits(bitsArray []byte, numBits uint32) bool {
+	used := numBits % 8
+	if used == 0 || len(bitsArray) == 0 {
+		return false
+	}
+	return bitsArray[len(bitsArray)-1]>>used != 0
+}
+
+// snapshot returns the bit array and insert count for use by another filter.
+// A concurrent filter hands out a copy taken under its read lock, so callers
+// never hold two filters' locks at once; other filters return their own
+// slice.
+func (b *BloomFilter) snapshot() ([]byte, uint32) {
+	if !b.concurrent {
+		return b.bitsArray, b.count
+	}
+	b.rlock()
+	defer b.runlock()
+	return bytes.Clone(b.bitsArray), b.count
+}
+
+// Stats describes a filter's parameters and current occupancy.
+type Stats struct {
+	NumBits          uint32
+	NumHashFunctions uint32
+	MaxSize          uint32
+	Seed             uint32
+	SetBits          uint32
+	FillRatio        float64
+}
+
+func (b *BloomFilter) Stats() Stats {
+	setBits := b.setBitCount()
+	return Stats{
+		NumBits:          b.numBits,
+		NumHashFunctions: b.numHashFunctions,
+		MaxSize:          b.maxSize,
+		Seed:             b.seed,
+		SetBits:          setBits,
+		FillRatio:        float64(setBits) / float64(b.numBits),
+	}
+}
+
 func (b *BloomFilter) HashFunctions() []hashFunction {
 	cp := make([]hashFunction, len(b.hashFunctions))
 	copy(cp, b.hashFunctions)
@@ -51,13 +302,79 @@ func (b *BloomFilter) HashFunctions() []hashFunction {
 }
 
 func (b *BloomFilter) Insert(value string) {
+	b.InsertBytes(stringBytes(value))
+}
+
+// InsertBytes inserts a raw key. Insert(s) and InsertBytes([]byte(s)) set
+// the same bits.
+func (b *BloomFilter) InsertBytes(value []byte) {
+	b.lock()
+	defer b.unlock()
 	for _, p := range b.key2Positions(value) {
 		writeBit(b.bitsArray, p)
 	}
-	b.count++
+	b.addCount(1)
+}
+
+// Reset clears every bit and the insert count without reallocating, keeping
+// the size, hash functions and seed.
+func (b *BloomFilter) Reset() {
+	b.lock()
+	defer b.unlock()
+	clear(b.bitsArray)
+	b.count = 0
+}
+
+// InsertMany inserts every value, reusing one position buffer for the batch.
+func (b *BloomFilter) InsertMany(values []string) {
+	b.lock()
+	defer b.unlock()
+	var positions []uint32
+	for _, value := range values {
+		positions = hashPositions(positions, stringBytes(value), b.hasher, b.hashFunctions)
+		for _, p := range positions {
+			writeBit(b.bitsArray, p)
+		}
+	}
+	b.addCount(uint32(min(uint64(len(values)), math.MaxUint32)))
+}
+
+// ContainsMany reports Contains for every value, in the same order.
+func (b *BloomFilter) ContainsMany(values []string) []bool {
+	b.rlock()
+	defer b.runlock()
+	results := make([]bool, len(values))
+	var positions []uint32
+	for i, value := range values {
+		positions = hashPositions(positions, stringBytes(value), b.hasher, b.hashFunctions)
+		results[i] = true
+		for _, p := range positions {
+			if !readBit(b.bitsArray, p) {
+				results[i] = false
+				break
+			}
+		}
+	}
+	return results
+}
+
+func (b *BloomFilter) InsertFromReader(r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	count := 0
+	for scanner.Scan() {
+		b.InsertBytes(scanner.Bytes())
+		count++
+	}
+	return count, scanner.Err()
 }
 
 func (b *BloomFilter) Contains(value string) bool {
+	return b.ContainsBytes(stringBytes(value))
+}
+
+func (b *BloomFilter) ContainsBytes(value []byte) bool {
+	b.rlock()
+	defer b.runlock()
 	for _, p := range b.key2Positions(value) {
 		if !readBit(b.bitsArray, p) {
 			return false
@@ -67,6 +384,8 @@ func (b *BloomFilter) Contains(value string) bool {
 }
 
 func (b *BloomFilter) FalsePositiveProbability() float64 {
+	b.rlock()
+	defer b.runlock()
 	if b.numBits == 0 || b.numHashFunctions == 0 || b.count == 0 {
 		return 0
 	}
@@ -76,26 +395,262 @@ func (b *BloomFilter) FalsePositiveProbability() float64 {
 	return math.Pow(1-math.Exp(-k*n/m), k)
 }
 
-func (b *BloomFilter) key2Positions(key string) []uint32 {
-	h1 := murmur3.SeedSum32(b.seed, []byte(key))
+func (b *BloomFilter) PositionsFor(key string) []uint32 {
+	return b.key2Positions(stringBytes(key))
+}
+
+func (b *BloomFilter) SetBits() []uint32 {
+	b.rlock()
+	defer b.runlock()
+	bits := make([]uint32, 0)
+	for i := uint32(0); i < b.numBits; i++ {
+		if readBit(b.bitsArray, i) {
+			bits = append(bits, i)
+		}
+	}
+	return bits
+}
 
-	f := fnv.New32a()
-	_, _ = f.Write([]byte(key))
-	h2 := f.Sum32()
+// Membership returns the fraction of value's positions that are set: 1.0 when
+// Contains would report true, lower values as a crude closeness signal. It is
+// a heuristic, not a probability.
+func (b *BloomFilter) Membership(value string) float64 {
+	positions := b.key2Positions(stringBytes(value))
+	if len(positions) == 0 {
+		return 0
+	}
+	b.rlock()
+	defer b.runlock()
+	set := 0
+	for _, p := range positions {
+		if readBit(b.bitsArray, p) {
+			set++
+		}
+	}
+	return float64(set) / float64(len(positions))
+}
+
+// DefinitelyAbsent is the negation of Contains: true means value was never
+// inserted. It stops at the first unset bit.
+func (b *BloomFilter) DefinitelyAbsent(value string) bool {
+	return !b.Contains(value)
+}
+
+// WouldAddCount returns how many of keys are not yet reported as present,
+// i.e. how many would be new if inserted. The filter is not modified, so false
+// positives make this a lower bound.
+func (b *BloomFilter) WouldAddCount(keys []string) int {
+	count := 0
+	for _, key := range keys {
+		if !b.Contains(key) {
+			count++
+		}
+	}
+	return count
+}
+
+// EstimateCount estimates the number of distinct keys inserted from the
+// number of set bits, n ≈ -(m/k) * ln(1 - X/m). Unlike the insert count it
+// ignores repeated keys and reflects keys merged in by Union.
+func (b *BloomFilter) EstimateCount() uint32 {
+	return clampEstimate(b.estimateFromSetBits(b.setBitCount()))
+}
+
+// RemainingCapacity returns how many more keys fit before maxSize is reached,
+// based on EstimateCount, so repeated keys do not use up capacity.
+func (b *BloomFilter) RemainingCapacity() uint32 {
+	est := b.EstimateCount()
+	if est >= b.maxSize {
+		return 0
+	}
+	return b.maxSize - est
+}
+
+func (b *BloomFilter) FillRatio() float64 {
+	if b.numBits == 0 {
+		return 0
+	}
+	return float64(b.setBitCount()) / float64(b.numBits)
+}
+
+// CurrentFalsePositiveRate returns (X/m)^k from the bits actually set, which
+// keeps tracking the real rate once more than maxSize keys are inserted.
+func (b *BloomFilter) CurrentFalsePositiveRate() float64 {
+	return math.Pow(b.FillRatio(), float64(b.numHashFunctions))
+}
+
+func (b *BloomFilter) OptimalFillRatio() float64 {
+	return 0.5
+}
+
+func (b *BloomFilter) DistanceFromOptimal() float64 {
+	return b.FillRatio() - b.OptimalFillRatio()
+}
+
+func (b *BloomFilter) setBitCount() uint32 {
+	b.rlock()
+	defer b.runlock()
+	var count int
+	for _, v := range b.bitsArray {
+		count += bits.OnesCount8(v)
+	}
+	return uint32(count)
+}
+
+// addCount adds n to count, saturating at MaxUint32. Callers hold the lock.
+func (b *BloomFilter) addCount(n uint32) {
+	b.count += min(n, math.MaxUint32-b.count)
+}
+
+func (b *BloomFilter) lock() {
+	if b.concurrent {
+		b.mu.Lock()
+	}
+}
+
+func (b *BloomFilter) unlock() {
+	if b.concurrent {
+		b.mu.Unlock()
+	}
+}
+
+func (b *BloomFilter) rlock() {
+	if b.concurrent {
+		b.mu.RLock()
+	}
+}
 
-	pos := make([]uint32, b.numHashFunctions)
-	for i, hf := range b.hashFunctions {
+func (b *BloomFilter) runlock() {
+	if b.concurrent {
+		b.mu.RUnlock()
+	}
+}
+
+func (b *BloomFilter) compatible(other *BloomFilter) bool {
+	return b.numBits == other.numBits &&
+		b.numHashFunctions == other.numHashFunctions &&
+		b.seed == other.seed &&
+		b.scheme == other.scheme
+}
+
+// estimateFromSetBits applies n ≈ -(m/k) * ln(1 - X/m). A saturated filter is
+// treated as having half a bit unset so the estimate stays finite.
+func (b *BloomFilter) estimateFromSetBits(x uint32) float64 {
+	if b.numBits == 0 || b.numHashFunctions == 0 {
+		return 0
+	}
+	m := float64(b.numBits)
+	k := float64(b.numHashFunctions)
+	fx := math.Min(float64(x), m-0.5)
+	return -(m / k) * math.Log(1-fx/m)
+}
+
+// orSetBitCount counts the bits set in the OR of filters. Each filter is ORed
+// into a scratch array under its own read lock, one at a time, so two calls
+// with the filters in different orders cannot deadlock.
+func orSetBitCount(filters ...*BloomFilter) uint32 {
+	acc := make([]byte, len(filters[0].bitsArray))
+	for _, f := range filters {
+		f.rlock()
+		for i, v := range f.bitsArray {
+			acc[i] |= v
+		}
+		f.runlock()
+	}
+	var count int
+	for _, v := range acc {
+		count += bits.OnesCount8(v)
+	}
+	return uint32(count)
+}
+
+func clampEstimate(est float64) uint32 {
+	if est <= 0 {
+		return 0
+	}
+	if est >= math.MaxUint32 {
+		return math.MaxUint32
+	}
+	return uint32(math.Round(est))
+}
+
+func (b *BloomFilter) key2Positions(key []byte) []uint32 {
+	return hashPositions(nil, key, b.hasher, b.hashFunctions)
+}
+
+// hashPositions derives one bit position per hash function from the two base
+// hashes of key. The positions are written into dst, which is reused when it
+// has enough capacity.
+func hashPositions(dst []uint32, key []byte, hasher Hasher, hashFunctions []hashFunction) []uint32 {
+	h1, h2 := hasher.Hash(key)
+
+	pos := dst[:0]
+	if cap(pos) < len(hashFunctions) {
+		pos = make([]uint32, 0, len(hashFunctions))
+	}
+	pos = pos[:len(hashFunctions)]
+	for i, hf := range hashFunctions {
 		pos[i] = hf(h1, h2)
 	}
 	return pos
 }
 
+// stringBytes views s as a byte slice without copying. The hash functions only
+// read their input, so the string's immutability is preserved.
+func stringBytes(s string) []byte {
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
+
+func (s HashingScheme) hashFunctions(k, numBits uint32) []hashFunction {
+	if s == EnhancedDoubleHashing {
+		return initEnhancedHashFunctions(k, numBits)
+	}
+	return initHashFunctions(k, numBits)
+}
+
+// initEnhancedHashFunctions uses the closed form of enhanced double hashing,
+// h1 + i*h2 + (i^3-i)/6, reduced modulo numBits at every step.
+func initEnhancedHashFunctions(k, numBits uint32) []hashFunction {
+	hs := make([]hashFunction, k)
+	for i := uint32(0); i < k; i++ {
+		j := uint64(i)
+		cubic := (j*j*j - j) / 6 % uint64(numBits)
+		hs[i] = func(h1, h2 uint32) uint32 {
+			return uint32((uint64(h1) + j*uint64(h2) + cubic) % uint64(numBits))
+		}
+	}
+	return hs
+}
+
+// nextPrime returns the smallest prime >= n.
+func nextPrime(n uint32) uint32 {
+	for p := uint64(max(n, 2)); ; p++ {
+		if isPrime(p) {
+			return uint32(p)
+		}
+	}
+}
+
+func isPrime(n uint64) bool {
+	if n < 2 {
+		return false
+	}
+	for d := uint64(2); d*d <= n; d++ {
+		if n%d == 0 {
+			return false
+		}
+	}
+	return true
+}
+
 func initHashFunctions(k, numBits uint32) []hashFunction {
 	hs := make([]hashFunction, k)
 	for i := uint32(0); i < k; i++ {
 		j := i
+		// Mixing in uint64 keeps j*h2 from wrapping, which would skew the
+		// positions before the modulo.
 		hs[i] = func(h1, h2 uint32) uint32 {
-			return (h1 + j*h2 + j*j) % numBits
+			return uint32((uint64(h1) + uint64(j)*uint64(h2) + uint64(j)*uint64(j)) % uint64(numBits))
 		}
 	}
 	return hs
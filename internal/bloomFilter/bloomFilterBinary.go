@@ -0,0 +1,82 @@
+package bloomfilter
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var ErrInvalidEncoding = errors.New("bloomfilter: invalid binary encoding")
+
+// ErrCustomHasher is returned by MarshalBinary for a filter built with
+// NewBloomFilterWithHasher: the hasher cannot be stored, and decoding with the
+// default one would silently report inserted keys as absent.
+var ErrCustomHasher = errors.New("bloomfilter: cannot encode a filter with a custom Hasher")
+
+// ErrUnsupportedVersion is returned by UnmarshalBinary for an encoding written
+// by a newer format version.
+var ErrUnsupportedVersion = errors.New("bloomfilter: unsupported encoding version")
+
+// The encoding starts with formatMagic and formatVersion, so other data and
+// future layouts are rejected instead of decoded as garbage.
+const (
+	formatMagic   = "BLMF"
+	formatVersion = 1
+	prefixSize    = len(formatMagic) + 4
+)
+
+// headerSize covers the prefix, numBits, numHashFunctions, maxSize, seed, count
+// and the hashing scheme.
+const headerSize = prefixSize + 6*4
+
+// MarshalBinary encodes the filter parameters followed by the bit array. The
+// hash functions are not stored; they are rebuilt from the parameters, so only
+// filters using the default hasher can be encoded.
+func (b *BloomFilter) MarshalBinary() ([]byte, error) {
+	b.rlock()
+	defer b.runlock()
+	if b.hasher != (murmurFNVHasher{seed: b.seed}) {
+		return nil, ErrCustomHasher
+	}
+	data := make([]byte, headerSize, headerSize+len(b.bitsArray))
+	copy(data, formatMagic)
+	binary.LittleEndian.PutUint32(data[len(formatMagic):], formatVersion)
+	header := data[prefixSize:]
+	binary.LittleEndian.PutUint32(header[0:], b.numBits)
+	binary.LittleEndian.PutUint32(header[4:], b.numHashFunctions)
+	binary.LittleEndian.PutUint32(header[8:], b.maxSize)
+	binary.LittleEndian.PutUint32(header[12:], b.seed)
+	binary.LittleEndian.PutUint32(header[16:], b.count)
+	binary.LittleEndian.PutUint32(header[20:], uint32(b.scheme))
+	return append(data, b.bitsArray...), nil
+}
+
+func (b *BloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < headerSize || string(data[:len(formatMagic)]) != formatMagic {
+		return ErrInvalidEncoding
+	}
+	if binary.LittleEndian.Uint32(data[len(formatMagic):]) != formatVersion {
+		return ErrUnsupportedVersion
+	}
+	header := data[prefixSize:]
+	numBits := binary.LittleEndian.Uint32(header[0:])
+	k := binary.LittleEndian.Uint32(header[4:])
+	bitsArray := data[headerSize:]
+	scheme := HashingScheme(binary.LittleEndian.Uint32(header[20:]))
+	if numBits == 0 || k == 0 || uint64(len(bitsArray)) != (uint64(numBits)+7)/8 || scheme > EnhancedDoubleHashing {
+		return ErrInvalidEncoding
+	}
+
+	b.lock()
+	defer b.unlock()
+	b.numBits = numBits
+	b.numHashFunctions = k
+	b.maxSize = binary.LittleEndian.Uint32(header[8:])
+	b.seed = binary.LittleEndian.Uint32(header[12:])
+	b.hasher = murmurFNVHasher{seed: b.seed}
+	b.count = binary.LittleEndian.Uint32(header[16:])
+	b.bitsArray = make([]byte, len(bitsArray))
+	copy(b.bitsArray, bitsArray)
+	b.scheme = scheme
+	b.hashFunctions = scheme.hashFunctions(k, numBits)
+	return nil
+}
@@ -1,10 +1,16 @@
 package bloomfilter
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"github.com/twmb/murmur3"
 	"math"
 	"math/rand"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -76,8 +82,8 @@ func TestPositionsDeterministicAndInRange(t *testing.T) {
 	bf := NewBloomFilter(1000, 0.02, 10101)
 
 	key := "hello-world"
-	p1 := bf.key2Positions(key)
-	p2 := bf.key2Positions(key)
+	p1 := bf.key2Positions([]byte(key))
+	p2 := bf.key2Positions([]byte(key))
 
 	if !reflect.DeepEqual(p1, p2) {
 		t.Fatalf("positions not deterministic: %v vs %v", p1, p2)
@@ -149,3 +155,1046 @@ func TestKMatchesFormula(t *testing.T) {
 		t.Fatalf("k=%d, want≈%d (±1 allowed)", bf.numHashFunctions, wantK)
 	}
 }
+
+func TestSetBitsMatchesPositionsUnion(t *testing.T) {
+	t.Parallel()
+
+	bf := NewBloomFilter(100, 0.01, 5)
+	if got := bf.SetBits(); len(got) != 0 {
+		t.Fatalf("empty filter has set bits: %v", got)
+	}
+
+	want := make(map[uint32]struct{})
+	for _, k := range []string{"alpha", "beta", "gamma", "delta"} {
+		bf.Insert(k)
+		for _, p := range bf.PositionsFor(k) {
+			want[p] = struct{}{}
+		}
+	}
+
+	got := bf.SetBits()
+	if len(got) != len(want) {
+		t.Fatalf("set bits=%d, want=%d", len(got), len(want))
+	}
+	for i, p := range got {
+		if _, ok := want[p]; !ok {
+			t.Fatalf("unexpected set bit %d", p)
+		}
+		if i > 0 && got[i-1] >= p {
+			t.Fatalf("set bits not sorted: %v", got)
+		}
+	}
+}
+
+func TestNewBloomFilterFromBitsForcesPositive(t *testing.T) {
+	t.Parallel()
+
+	const k, seed = 3, 17
+	probe := NewBloomFilterFromBits(make([]byte, 32), k, seed)
+
+	bits := make([]byte, 32)
+	for _, p := range probe.PositionsFor("never-inserted") {
+		writeBit(bits, p)
+	}
+
+	bf := NewBloomFilterFromBits(bits, k, seed)
+	if bf.numBits != 256 {
+		t.Fatalf("numBits=%d, want=256", bf.numBits)
+	}
+	if !bf.Contains("never-inserted") {
+		t.Fatalf("crafted key must be reported present")
+	}
+
+	bits[0] ^= 0xff
+	if !bf.Contains("never-inserted") {
+		t.Fatalf("filter must not alias the input slice")
+	}
+}
+
+func TestNewBloomFilterFromBitsInvalidPanics(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		bits []byte
+		k    uint32
+	}{
+		{nil, 3},
+		{make([]byte, 4), 0},
+	}
+	for _, c := range cases {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Fatalf("expected panic for len(bits)=%d k=%d", len(c.bits), c.k)
+				}
+			}()
+			_ = NewBloomFilterFromBits(c.bits, c.k, 1)
+		}()
+	}
+}
+
+func TestBuildBloomFilterWithReportCountsDuplicates(t *testing.T) {
+	t.Parallel()
+
+	keys := make([]string, 0, 1100)
+	for i := 0; i < 1000; i++ {
+		keys = append(keys, fmt.Sprintf("key_%d", i))
+	}
+	for i := 0; i < 100; i++ {
+		keys = append(keys, fmt.Sprintf("key_%d", i))
+	}
+
+	bf, collisions := BuildBloomFilterWithReport(keys, 0.001, 3)
+	if collisions < 100 || collisions > 110 {
+		t.Fatalf("collisions=%d, want about 100", collisions)
+	}
+	for _, k := range keys {
+		if !bf.Contains(k) {
+			t.Fatalf("false negative for %q", k)
+		}
+	}
+
+	if _, c := BuildBloomFilterWithReport(nil, 0.01, 3); c != 0 {
+		t.Fatalf("empty key set: collisions=%d, want 0", c)
+	}
+}
+
+func TestDistanceFromOptimalShrinksThenGrows(t *testing.T) {
+	t.Parallel()
+
+	n := 2000
+	bf := NewBloomFilter(uint32(n), 0.01, 8)
+	if bf.OptimalFillRatio() != 0.5 {
+		t.Fatalf("OptimalFillRatio=%v, want 0.5", bf.OptimalFillRatio())
+	}
+
+	empty := math.Abs(bf.DistanceFromOptimal())
+	if empty != 0.5 {
+		t.Fatalf("empty distance=%v, want 0.5", empty)
+	}
+
+	for i := 0; i < n; i++ {
+		bf.Insert(fmt.Sprintf("k_%d", i))
+	}
+	atCapacity := math.Abs(bf.DistanceFromOptimal())
+	if atCapacity >= empty || atCapacity > 0.05 {
+		t.Fatalf("distance at capacity=%v, want close to 0", atCapacity)
+	}
+
+	for i := n; i < 4*n; i++ {
+		bf.Insert(fmt.Sprintf("k_%d", i))
+	}
+	overfilled := bf.DistanceFromOptimal()
+	if overfilled <= atCapacity {
+		t.Fatalf("distance overfilled=%v, want > %v", overfilled, atCapacity)
+	}
+}
+
+func TestInsertFromReader(t *testing.T) {
+	t.Parallel()
+
+	bf := NewBloomFilter(100, 0.01, 11)
+	n, err := bf.InsertFromReader(strings.NewReader("apple\nbanana\ncherry\n\ndate"))
+	if err != nil {
+		t.Fatalf("InsertFromReader: %v", err)
+	}
+	if n != 5 {
+		t.Fatalf("inserted=%d, want=5", n)
+	}
+	for _, k := range []string{"apple", "banana", "cherry", "", "date"} {
+		if !bf.Contains(k) {
+			t.Fatalf("false negative for %q", k)
+		}
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("boom")
+}
+
+func TestInsertFromReaderSurfacesErrors(t *testing.T) {
+	t.Parallel()
+
+	bf := NewBloomFilter(100, 0.01, 11)
+	if _, err := bf.InsertFromReader(failingReader{}); err == nil {
+		t.Fatalf("expected reader error")
+	}
+}
+
+func TestShardedBloomFilterConcurrentInsert(t *testing.T) {
+	t.Parallel()
+
+	const shards, workers, perWorker = 4, 8, 500
+	sf := NewShardedBloomFilter(shards, workers*perWorker/shards*2, 0.01, 21, nil)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				k := fmt.Sprintf("w%d_%d", w, i)
+				sf.Insert(k)
+				_ = sf.Contains(k)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for w := 0; w < workers; w++ {
+		for i := 0; i < perWorker; i++ {
+			if k := fmt.Sprintf("w%d_%d", w, i); !sf.Contains(k) {
+				t.Fatalf("false negative for %q", k)
+			}
+		}
+	}
+
+	stats := sf.ShardStats()
+	if len(stats) != shards {
+		t.Fatalf("stats len=%d, want=%d", len(stats), shards)
+	}
+	for i, fill := range stats {
+		if fill <= 0 || fill >= 1 {
+			t.Fatalf("shard %d fill=%v, want in (0,1)", i, fill)
+		}
+	}
+}
+
+func TestShardedBloomFilterCustomPartition(t *testing.T) {
+	t.Parallel()
+
+	sf := NewShardedBloomFilter(3, 100, 0.01, 1, func(key string) int { return -len(key) })
+	sf.Insert("ab")
+	stats := sf.ShardStats()
+	if stats[1] == 0 || stats[0] != 0 || stats[2] != 0 {
+		t.Fatalf("key routed to unexpected shard: %v", stats)
+	}
+	if !sf.Contains("ab") {
+		t.Fatalf("false negative")
+	}
+}
+
+func TestRemainingCapacityDecreases(t *testing.T) {
+	t.Parallel()
+
+	n := uint32(500)
+	bf := NewBloomFilter(n, 0.01, 4)
+	if got := bf.RemainingCapacity(); got != n {
+		t.Fatalf("fresh RemainingCapacity=%d, want=%d", got, n)
+	}
+
+	for i := 0; i < 100; i++ {
+		bf.Insert("rc_0")
+	}
+	if got := bf.RemainingCapacity(); got < n-1 {
+		t.Fatalf("RemainingCapacity=%d after repeating one key, want >= %d", got, n-1)
+	}
+
+	prev := bf.RemainingCapacity()
+	for i := uint32(0); i < n; i++ {
+		bf.Insert(fmt.Sprintf("rc_%d", i))
+		got := bf.RemainingCapacity()
+		if got > prev {
+			t.Fatalf("RemainingCapacity grew from %d to %d", prev, got)
+		}
+		prev = got
+	}
+	if prev > n/20 {
+		t.Fatalf("RemainingCapacity=%d at maxSize, want near 0", prev)
+	}
+
+	for i := uint32(0); i < n; i++ {
+		bf.Insert(fmt.Sprintf("extra_%d", i))
+	}
+	if got := bf.RemainingCapacity(); got != 0 {
+		t.Fatalf("RemainingCapacity=%d past maxSize, want 0", got)
+	}
+}
+
+func TestDefinitelyAbsentNegatesContains(t *testing.T) {
+	t.Parallel()
+
+	bf := NewBloomFilter(200, 0.05, 6)
+	for i := 0; i < 200; i++ {
+		bf.Insert(fmt.Sprintf("in_%d", i))
+	}
+	for i := 0; i < 200; i++ {
+		if bf.DefinitelyAbsent(fmt.Sprintf("in_%d", i)) {
+			t.Fatalf("inserted key reported absent")
+		}
+	}
+	absent := 0
+	for i := 0; i < 2000; i++ {
+		k := fmt.Sprintf("out_%d", i)
+		if bf.DefinitelyAbsent(k) == bf.Contains(k) {
+			t.Fatalf("DefinitelyAbsent(%q) is not the negation of Contains", k)
+		}
+		if bf.DefinitelyAbsent(k) {
+			absent++
+		}
+	}
+	if absent == 0 {
+		t.Fatalf("no fresh key reported absent")
+	}
+}
+
+func TestMembership(t *testing.T) {
+	t.Parallel()
+
+	bf := NewBloomFilter(1000, 0.01, 12)
+	for i := 0; i < 100; i++ {
+		bf.Insert(fmt.Sprintf("m_%d", i))
+	}
+	for i := 0; i < 100; i++ {
+		if got := bf.Membership(fmt.Sprintf("m_%d", i)); got != 1 {
+			t.Fatalf("inserted key membership=%v, want 1", got)
+		}
+	}
+
+	below := 0
+	for i := 0; i < 1000; i++ {
+		got := bf.Membership(fmt.Sprintf("fresh_%d", i))
+		if got < 0 || got > 1 {
+			t.Fatalf("membership=%v out of [0,1]", got)
+		}
+		if got < 1 {
+			below++
+		}
+	}
+	if below < 950 {
+		t.Fatalf("only %d/1000 fresh keys below 1.0", below)
+	}
+}
+
+func TestIntersectionCount3(t *testing.T) {
+	t.Parallel()
+
+	a := NewBloomFilter(10000, 0.01, 31)
+	b := NewBloomFilter(10000, 0.01, 31)
+	c := NewBloomFilter(10000, 0.01, 31)
+
+	insert := func(prefix string, n int, filters ...*BloomFilter) {
+		for i := 0; i < n; i++ {
+			k := fmt.Sprintf("%s_%d", prefix, i)
+			for _, f := range filters {
+				f.Insert(k)
+			}
+		}
+	}
+	insert("abc", 1000, a, b, c)
+	insert("ab", 500, a, b)
+	insert("bc", 500, b, c)
+	insert("a", 2000, a)
+	insert("b", 2000, b)
+	insert("c", 2000, c)
+
+	got, err := IntersectionCount3(a, b, c)
+	if err != nil {
+		t.Fatalf("IntersectionCount3: %v", err)
+	}
+	if got < 800 || got > 1200 {
+		t.Fatalf("three-way estimate=%d, want about 1000", got)
+	}
+
+	pair, err := IntersectionCount(a, b)
+	if err != nil {
+		t.Fatalf("IntersectionCount: %v", err)
+	}
+	if pair < 1300 || pair > 1700 {
+		t.Fatalf("pairwise estimate=%d, want about 1500", pair)
+	}
+
+	d := NewBloomFilter(10000, 0.01, 31)
+	insert("d", 1000, d)
+	if got, _ := IntersectionCount3(a, b, d); got > 200 {
+		t.Fatalf("disjoint estimate=%d, want near 0", got)
+	}
+
+	other := NewBloomFilter(10000, 0.01, 32)
+	if _, err := IntersectionCount3(a, b, other); err != ErrIncompatibleFilters {
+		t.Fatalf("err=%v, want=%v", err, ErrIncompatibleFilters)
+	}
+	if _, err := IntersectionCount(a, other); err != ErrIncompatibleFilters {
+		t.Fatalf("pairwise err=%v, want=%v", err, ErrIncompatibleFilters)
+	}
+}
+
+func TestWouldAddCount(t *testing.T) {
+	t.Parallel()
+
+	bf := NewBloomFilter(2000, 0.01, 8)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("wa_%d", i)
+		if i%2 == 0 {
+			bf.Insert(keys[i])
+		}
+	}
+	before := bf.SetBits()
+
+	got := bf.WouldAddCount(keys)
+	if got > 500 || got < 480 {
+		t.Fatalf("WouldAddCount=%d, want about 500", got)
+	}
+	if after := bf.SetBits(); len(after) != len(before) {
+		t.Fatalf("WouldAddCount modified the filter: %d -> %d set bits", len(before), len(after))
+	}
+	if got := bf.WouldAddCount(nil); got != 0 {
+		t.Fatalf("WouldAddCount(nil)=%d, want 0", got)
+	}
+}
+
+func TestUnionCountSaturates(t *testing.T) {
+	t.Parallel()
+
+	a := NewBloomFilter(100, 0.01, 11)
+	b := NewBloomFilter(100, 0.01, 11)
+	a.count = math.MaxUint32 - 1
+	b.count = 5
+	if err := a.Union(b); err != nil {
+		t.Fatalf("Union: %v", err)
+	}
+	if a.count != math.MaxUint32 {
+		t.Fatalf("count=%d after Union, want saturation at MaxUint32", a.count)
+	}
+}
+
+func TestUnion(t *testing.T) {
+	t.Parallel()
+
+	a := NewBloomFilter(1000, 0.01, 11)
+	b := NewBloomFilter(1000, 0.01, 11)
+	for i := 0; i < 400; i++ {
+		a.Insert(fmt.Sprintf("a_%d", i))
+		b.Insert(fmt.Sprintf("b_%d", i))
+	}
+
+	if err := a.Union(b); err != nil {
+		t.Fatalf("Union: %v", err)
+	}
+	for i := 0; i < 400; i++ {
+		if !a.Contains(fmt.Sprintf("a_%d", i)) || !a.Contains(fmt.Sprintf("b_%d", i)) {
+			t.Fatalf("union lost key %d", i)
+		}
+	}
+
+	for _, other := range []*BloomFilter{
+		NewBloomFilter(1000, 0.01, 12),
+		NewBloomFilter(2000, 0.01, 11),
+		NewBloomFilter(1000, 0.2, 11),
+	} {
+		if err := a.Union(other); !errors.Is(err, ErrIncompatibleFilters) {
+			t.Fatalf("Union of incompatible filters: err=%v", err)
+		}
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	t.Parallel()
+
+	a := NewBloomFilter(1000, 0.01, 13)
+	b := NewBloomFilter(1000, 0.01, 13)
+	for i := 0; i < 300; i++ {
+		a.Insert(fmt.Sprintf("shared_%d", i))
+		b.Insert(fmt.Sprintf("shared_%d", i))
+		a.Insert(fmt.Sprintf("a_%d", i))
+		b.Insert(fmt.Sprintf("b_%d", i))
+	}
+
+	if err := a.Intersect(b); err != nil {
+		t.Fatalf("Intersect: %v", err)
+	}
+	falsePositives := 0
+	for i := 0; i < 300; i++ {
+		if !a.Contains(fmt.Sprintf("shared_%d", i)) {
+			t.Fatalf("intersection lost shared key %d", i)
+		}
+		if a.Contains(fmt.Sprintf("a_%d", i)) {
+			falsePositives++
+		}
+		if a.Contains(fmt.Sprintf("b_%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 60 {
+		t.Fatalf("%d of 600 disjoint keys survived the intersection", falsePositives)
+	}
+
+	if err := a.Intersect(NewBloomFilter(1000, 0.01, 14)); !errors.Is(err, ErrIncompatibleFilters) {
+		t.Fatalf("Intersect of incompatible filters: err=%v", err)
+	}
+}
+
+func TestCountingBloomFilter(t *testing.T) {
+	t.Parallel()
+
+	c := NewCountingBloomFilter(1000, 0.01, 15)
+	if c.Remove("missing") {
+		t.Fatalf("Remove of absent key returned true")
+	}
+
+	c.Insert("twice")
+	c.Insert("twice")
+	if !c.Remove("twice") || !c.Contains("twice") {
+		t.Fatalf("double insert then single remove must keep the key")
+	}
+	if !c.Remove("twice") || c.Contains("twice") {
+		t.Fatalf("second remove must delete the key")
+	}
+
+	for i := 0; i < 500; i++ {
+		c.Insert(fmt.Sprintf("k_%d", i))
+	}
+	for i := 0; i < 500; i += 2 {
+		if !c.Remove(fmt.Sprintf("k_%d", i)) {
+			t.Fatalf("Remove(k_%d) = false", i)
+		}
+	}
+	present := 0
+	for i := 0; i < 500; i++ {
+		ok := c.Contains(fmt.Sprintf("k_%d", i))
+		if i%2 == 1 && !ok {
+			t.Fatalf("false negative for k_%d after removing others", i)
+		}
+		if i%2 == 0 && ok {
+			present++
+		}
+	}
+	if present > 25 {
+		t.Fatalf("%d of 250 removed keys still reported present", present)
+	}
+}
+
+func TestCountingBloomFilterSaturates(t *testing.T) {
+	t.Parallel()
+
+	c := NewCountingBloomFilter(10, 0.1, 16)
+	for i := 0; i < 300; i++ {
+		c.Insert("hot")
+	}
+	for _, p := range hashPositions(nil, []byte("hot"), c.hasher, c.hashFunctions) {
+		if c.counters[p] != 255 {
+			t.Fatalf("counter=%d, want saturated at 255", c.counters[p])
+		}
+	}
+	for i := 0; i < 300; i++ {
+		c.Remove("hot")
+	}
+	if !c.Contains("hot") {
+		t.Fatalf("saturated counters must not be decremented")
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	bf := NewBloomFilter(2000, 0.01, 17)
+	for i := 0; i < 2000; i++ {
+		bf.Insert(fmt.Sprintf("bin_%d", i))
+	}
+
+	data, err := bf.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var restored BloomFilter
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("bin_%d", i)
+		if bf.Contains(key) != restored.Contains(key) {
+			t.Fatalf("Contains(%q) differs after round trip", key)
+		}
+	}
+	if restored.RemainingCapacity() != bf.RemainingCapacity() {
+		t.Fatalf("RemainingCapacity=%d, want %d", restored.RemainingCapacity(), bf.RemainingCapacity())
+	}
+
+	for _, bad := range [][]byte{nil, data[:10], data[:len(data)-1]} {
+		if err := restored.UnmarshalBinary(bad); !errors.Is(err, ErrInvalidEncoding) {
+			t.Fatalf("truncated input of %d bytes: err=%v", len(bad), err)
+		}
+	}
+}
+
+func TestBinaryRejectsBadPrefix(t *testing.T) {
+	t.Parallel()
+
+	data, err := NewBloomFilter(100, 0.01, 17).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	var restored BloomFilter
+
+	badMagic := bytes.Clone(data)
+	badMagic[0] ^= 0xff
+	if err := restored.UnmarshalBinary(badMagic); !errors.Is(err, ErrInvalidEncoding) {
+		t.Fatalf("bad magic: err=%v, want ErrInvalidEncoding", err)
+	}
+
+	badVersion := bytes.Clone(data)
+	badVersion[len(formatMagic)]++
+	if err := restored.UnmarshalBinary(badVersion); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("bad version: err=%v, want ErrUnsupportedVersion", err)
+	}
+}
+
+func TestBinaryRejectsMalformedHeader(t *testing.T) {
+	t.Parallel()
+
+	data, err := NewBloomFilter(100, 0.01, 17).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+	header := bytes.Clone(data[:headerSize])
+	binary.LittleEndian.PutUint32(header[prefixSize:], math.MaxUint32)
+
+	var restored BloomFilter
+	if err := restored.UnmarshalBinary(header); !errors.Is(err, ErrInvalidEncoding) {
+		t.Fatalf("numBits=MaxUint32 with no bit bytes: err=%v, want ErrInvalidEncoding", err)
+	}
+}
+
+func TestReset(t *testing.T) {
+	t.Parallel()
+
+	bf := NewBloomFilter(500, 0.01, 18)
+	for i := 0; i < 500; i++ {
+		bf.Insert(fmt.Sprintf("r_%d", i))
+	}
+	bf.Reset()
+
+	if len(bf.SetBits()) != 0 || bf.RemainingCapacity() != 500 {
+		t.Fatalf("after Reset: %d bits set, RemainingCapacity=%d", len(bf.SetBits()), bf.RemainingCapacity())
+	}
+	for i := 0; i < 500; i++ {
+		if bf.Contains(fmt.Sprintf("r_%d", i)) {
+			t.Fatalf("r_%d still present after Reset", i)
+		}
+	}
+
+	bf.Insert("again")
+	if !bf.Contains("again") {
+		t.Fatalf("filter unusable after Reset")
+	}
+}
+
+func TestEstimateCount(t *testing.T) {
+	t.Parallel()
+
+	bf := NewBloomFilter(5000, 0.01, 19)
+	if got := bf.EstimateCount(); got != 0 {
+		t.Fatalf("empty filter estimate=%d, want 0", got)
+	}
+
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("e_%d", i)
+		bf.Insert(key)
+		bf.Insert(key)
+	}
+	if got := bf.EstimateCount(); got < 2850 || got > 3150 {
+		t.Fatalf("estimate=%d for 3000 distinct keys, want within 5%%", got)
+	}
+
+	full := NewBloomFilterFromBits([]byte{0xff, 0xff}, 2, 0)
+	if got := full.EstimateCount(); got == 0 || got == math.MaxUint32 {
+		t.Fatalf("saturated filter estimate=%d, want finite and positive", got)
+	}
+}
+
+func TestCurrentFalsePositiveRate(t *testing.T) {
+	t.Parallel()
+
+	bf := NewBloomFilter(1000, 0.01, 20)
+	if got := bf.CurrentFalsePositiveRate(); got != 0 {
+		t.Fatalf("empty filter rate=%v, want 0", got)
+	}
+
+	prev := 0.0
+	for batch := 1; batch <= 4; batch++ {
+		for i := 0; i < 1000; i++ {
+			bf.Insert(fmt.Sprintf("fp_%d_%d", batch, i))
+		}
+		rate := bf.CurrentFalsePositiveRate()
+		if rate <= prev {
+			t.Fatalf("batch %d: rate %v did not grow from %v", batch, rate, prev)
+		}
+		prev = rate
+
+		hits := 0
+		const probes = 20000
+		for i := 0; i < probes; i++ {
+			if bf.Contains(fmt.Sprintf("probe_%d", i)) {
+				hits++
+			}
+		}
+		empirical := float64(hits) / probes
+		if math.Abs(empirical-rate) > 0.2*rate+0.005 {
+			t.Fatalf("batch %d: reported rate %v, empirical %v", batch, rate, empirical)
+		}
+	}
+}
+
+func TestBytesAndStringKeysInterchangeable(t *testing.T) {
+	t.Parallel()
+
+	byString := NewBloomFilter(500, 0.01, 21)
+	byBytes := NewBloomFilter(500, 0.01, 21)
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("x_%d", i)
+		byString.Insert(key)
+		byBytes.InsertBytes([]byte(key))
+	}
+	if !bytes.Equal(byString.bitsArray, byBytes.bitsArray) {
+		t.Fatalf("Insert and InsertBytes set different bits")
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("x_%d", i)
+		if byString.Contains(key) != byBytes.ContainsBytes([]byte(key)) {
+			t.Fatalf("Contains and ContainsBytes disagree on %q", key)
+		}
+	}
+	if !byString.ContainsBytes([]byte("x_1")) || !byBytes.Contains("x_1") {
+		t.Fatalf("keys inserted one way must be found the other way")
+	}
+}
+
+func TestInsertManyAndContainsMany(t *testing.T) {
+	t.Parallel()
+
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("m_%d", i)
+	}
+
+	batch := NewBloomFilter(1000, 0.01, 22)
+	single := NewBloomFilter(1000, 0.01, 22)
+	batch.InsertMany(keys[:500])
+	for _, k := range keys[:500] {
+		single.Insert(k)
+	}
+	if !bytes.Equal(batch.bitsArray, single.bitsArray) || batch.count != single.count {
+		t.Fatalf("InsertMany differs from repeated Insert")
+	}
+
+	got := batch.ContainsMany(keys)
+	if len(got) != len(keys) {
+		t.Fatalf("ContainsMany returned %d results for %d keys", len(got), len(keys))
+	}
+	for i, k := range keys {
+		if got[i] != single.Contains(k) {
+			t.Fatalf("ContainsMany[%d]=%v, Contains=%v", i, got[i], single.Contains(k))
+		}
+	}
+	if got := batch.ContainsMany(nil); len(got) != 0 {
+		t.Fatalf("ContainsMany(nil)=%v", got)
+	}
+}
+
+func TestConcurrentBloomFilter(t *testing.T) {
+	t.Parallel()
+
+	const workers, perWorker = 8, 500
+	bf := NewConcurrentBloomFilter(workers*perWorker, 0.01, 23)
+	other := NewConcurrentBloomFilter(workers*perWorker, 0.01, 23)
+	other.Insert("c_0_0")
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	loop := func(body func() error) {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if err := body(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	loop(func() error {
+		_ = bf.FalsePositiveProbability()
+		_ = bf.RemainingCapacity()
+		_ = bf.EstimateCount()
+		_ = bf.Equals(other)
+		if _, err := IntersectionCount(bf, other); err != nil {
+			return err
+		}
+		_, err := IntersectionCount3(bf, bf, other)
+		return err
+	})
+	// The same pairs in the opposite order, plus writers on both filters, so
+	// any lock-order dependency between filters would deadlock.
+	loop(func() error {
+		_ = other.Equals(bf)
+		if _, err := IntersectionCount(other, bf); err != nil {
+			return err
+		}
+		if err := other.Union(bf); err != nil {
+			return err
+		}
+		return bf.Union(other)
+	})
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				key := fmt.Sprintf("c_%d_%d", w, i)
+				bf.Insert(key)
+				if !bf.Contains(key) {
+					t.Errorf("key %q missing right after Insert", key)
+					return
+				}
+				_ = bf.FillRatio()
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(done)
+	readers.Wait()
+
+	for w := 0; w < workers; w++ {
+		for i := 0; i < perWorker; i++ {
+			if !bf.Contains(fmt.Sprintf("c_%d_%d", w, i)) {
+				t.Fatalf("lost key c_%d_%d", w, i)
+			}
+		}
+	}
+	if got := bf.RemainingCapacity(); got > workers*perWorker/20 {
+		t.Fatalf("RemainingCapacity=%d, want near 0 after %d inserts", got, workers*perWorker)
+	}
+}
+
+func TestScalableBloomFilterStaysBounded(t *testing.T) {
+	t.Parallel()
+
+	const fpRate = 0.01
+	s := NewScalableBloomFilter(1000, fpRate, 24)
+	const n = 50000
+	for i := 0; i < n; i++ {
+		s.Insert(fmt.Sprintf("s_%d", i))
+	}
+	if s.Stages() < 3 {
+		t.Fatalf("Stages=%d after %d inserts into capacity 1000, want growth", s.Stages(), n)
+	}
+
+	for i := 0; i < n; i++ {
+		if !s.Contains(fmt.Sprintf("s_%d", i)) {
+			t.Fatalf("false negative for s_%d", i)
+		}
+	}
+
+	target := s.FalsePositiveRate()
+	if target <= fpRate || target > 2*fpRate {
+		t.Fatalf("compounded target=%v, want in (%v, %v]", target, fpRate, 2*fpRate)
+	}
+	hits := 0
+	const probes = 50000
+	for i := 0; i < probes; i++ {
+		if s.Contains(fmt.Sprintf("probe_%d", i)) {
+			hits++
+		}
+	}
+	if rate := float64(hits) / probes; rate > 1.5*target {
+		t.Fatalf("empirical rate=%v exceeds compounded target %v", rate, target)
+	}
+}
+
+func TestEquals(t *testing.T) {
+	t.Parallel()
+
+	a := NewBloomFilter(95, 0.05, 25)
+	b := NewBloomFilter(95, 0.05, 25)
+	if a.numBits%8 == 0 {
+		t.Fatalf("test needs numBits not divisible by 8, got %d", a.numBits)
+	}
+	for i := 0; i < 50; i++ {
+		a.Insert(fmt.Sprintf("eq_%d", i))
+		b.Insert(fmt.Sprintf("eq_%d", i))
+	}
+	if !a.Equals(b) || !b.Equals(a) {
+		t.Fatalf("filters with the same keys must be equal")
+	}
+
+	b.Insert("one-more")
+	if a.Equals(b) {
+		t.Fatalf("filters differing by one key reported equal")
+	}
+
+	for _, other := range []*BloomFilter{
+		NewBloomFilter(95, 0.05, 26),
+		NewBloomFilter(190, 0.05, 25),
+	} {
+		if NewBloomFilter(95, 0.05, 25).Equals(other) {
+			t.Fatalf("filters with different parameters reported equal")
+		}
+	}
+
+	c := NewBloomFilter(95, 0.05, 25)
+	d := NewBloomFilter(95, 0.05, 25)
+	c.bitsArray[len(c.bitsArray)-1] |= 0x80
+	d.bitsArray[len(d.bitsArray)-1] |= 0x80
+	if c.Equals(d) {
+		t.Fatalf("filters with bits set past numBits reported equal")
+	}
+}
+
+type constantHasher struct{ h1, h2 uint32 }
+
+func (h constantHasher) Hash([]byte) (uint32, uint32) { return h.h1, h.h2 }
+
+func TestCustomHasher(t *testing.T) {
+	t.Parallel()
+
+	bf := NewBloomFilterWithHasher(100, 0.01, constantHasher{h1: 5, h2: 3})
+	want := make([]uint32, bf.numHashFunctions)
+	for i, hf := range bf.hashFunctions {
+		want[i] = hf(5, 3)
+	}
+	if got := bf.PositionsFor("anything"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("PositionsFor=%v, want %v derived from the injected hasher", got, want)
+	}
+
+	bf.Insert("a")
+	if !bf.Contains("completely different key") {
+		t.Fatalf("every key hashes identically, so every key must be reported present")
+	}
+
+	def := NewBloomFilter(100, 0.01, 7)
+	h1, h2 := murmurFNVHasher{seed: 7}.Hash([]byte("k"))
+	for i, p := range def.PositionsFor("k") {
+		if p != def.hashFunctions[i](h1, h2) {
+			t.Fatalf("default filter does not use the murmur3+fnv hasher")
+		}
+	}
+}
+
+func TestMarshalBinaryRejectsCustomHasher(t *testing.T) {
+	t.Parallel()
+
+	bf := NewBloomFilterWithHasher(100, 0.01, constantHasher{h1: 5, h2: 3})
+	if _, err := bf.MarshalBinary(); err != ErrCustomHasher {
+		t.Fatalf("MarshalBinary err=%v, want ErrCustomHasher", err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	t.Parallel()
+
+	n, fpRate := uint32(1000), 0.01
+	bf := NewBloomFilter(n, fpRate, 27)
+	for i := 0; i < 100; i++ {
+		bf.Insert(fmt.Sprintf("st_%d", i))
+	}
+
+	ln2 := math.Ln2
+	wantBits := uint32(math.Ceil(float64(n) * -math.Log(fpRate) / (ln2 * ln2)))
+	wantK := uint32(math.Round(float64(wantBits) / float64(n) * ln2))
+
+	st := bf.Stats()
+	if st.NumBits != wantBits || st.NumHashFunctions != wantK || st.MaxSize != n || st.Seed != 27 {
+		t.Fatalf("Stats=%+v, want numBits=%d k=%d maxSize=%d seed=27", st, wantBits, wantK, n)
+	}
+	if st.SetBits != uint32(len(bf.SetBits())) || st.FillRatio != bf.FillRatio() {
+		t.Fatalf("Stats occupancy=%d/%v, want %d/%v", st.SetBits, st.FillRatio, len(bf.SetBits()), bf.FillRatio())
+	}
+}
+
+func TestFalsePositiveRateLargeFilter(t *testing.T) {
+	t.Parallel()
+
+	const n, fpRate = 200000, 0.001
+	bf := NewBloomFilter(n, fpRate, 28)
+	for i := 0; i < n; i++ {
+		bf.Insert(fmt.Sprintf("big_%d", i))
+	}
+
+	hits := 0
+	const probes = 200000
+	for i := 0; i < probes; i++ {
+		if bf.Contains(fmt.Sprintf("absent_%d", i)) {
+			hits++
+		}
+	}
+	if rate := float64(hits) / probes; rate > 2*fpRate {
+		t.Fatalf("empirical rate=%v with k=%d, m=%d, want near %v", rate, bf.numHashFunctions, bf.numBits, fpRate)
+	}
+}
+
+// sharedFactorHasher returns h1 and h2 that are exact multiples of factor.
+// With factor half the bit count of a default filter, every key reduces to one
+// of four position patterns, while over a prime bit count the multiples still
+// spread out.
+type sharedFactorHasher struct{ factor uint32 }
+
+func (h sharedFactorHasher) Hash(key []byte) (uint32, uint32) {
+	limit := math.MaxUint32 / h.factor
+	return murmur3.SeedSum32(1, key) % limit * h.factor, murmur3.SeedSum32(2, key) % limit * h.factor
+}
+
+func TestEnhancedDoubleHashing(t *testing.T) {
+	t.Parallel()
+
+	const n, fpRate = 5000, 0.01
+	defaultBits := NewBloomFilter(n, fpRate, 29).numBits
+	if defaultBits%2 != 0 {
+		t.Fatalf("default numBits=%d must be even for the shared-factor hasher", defaultBits)
+	}
+	hasher := sharedFactorHasher{factor: defaultBits / 2}
+	rates := make(map[HashingScheme]float64)
+	for _, scheme := range []HashingScheme{DoubleHashing, EnhancedDoubleHashing} {
+		bf := NewBloomFilterWithScheme(n, fpRate, 29, scheme)
+		bf.hasher = hasher
+		for i := 0; i < n; i++ {
+			bf.Insert(fmt.Sprintf("adv_%d", i))
+		}
+		for i := 0; i < n; i++ {
+			if !bf.Contains(fmt.Sprintf("adv_%d", i)) {
+				t.Fatalf("scheme %d: false negative", scheme)
+			}
+		}
+
+		hits := 0
+		const probes = 50000
+		for i := 0; i < probes; i++ {
+			if bf.Contains(fmt.Sprintf("probe_%d", i)) {
+				hits++
+			}
+		}
+		rates[scheme] = float64(hits) / probes
+	}
+
+	if rates[DoubleHashing] < 10*fpRate {
+		t.Fatalf("default rate=%v under the shared-factor hasher, want well above target %v", rates[DoubleHashing], fpRate)
+	}
+	if rates[EnhancedDoubleHashing] > 2*fpRate {
+		t.Fatalf("enhanced rate=%v, want near target %v", rates[EnhancedDoubleHashing], fpRate)
+	}
+
+	bf := NewBloomFilterWithScheme(n, fpRate, 29, EnhancedDoubleHashing)
+	if !isPrime(uint64(bf.numBits)) {
+		t.Fatalf("enhanced numBits=%d is not prime", bf.numBits)
+	}
+	if bf.compatible(NewBloomFilter(n, fpRate, 29)) {
+		t.Fatalf("filters with different schemes must not be compatible")
+	}
+
+	data, _ := bf.MarshalBinary()
+	var restored BloomFilter
+	if err := restored.UnmarshalBinary(data); err != nil || restored.scheme != EnhancedDoubleHashing {
+		t.Fatalf("scheme lost in binary round trip: err=%v scheme=%d", err, restored.scheme)
+	}
+}
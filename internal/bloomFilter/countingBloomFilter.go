@@ -0,0 +1,56 @@
+package bloomfilter
+
+import "math"
+
+// CountingBloomFilter replaces each bit with an 8-bit counter so keys can be
+// removed. A counter that reaches 255 saturates and is never decremented
+// again, since its true count is no longer known; this can only cause false
+// positives, never false negatives.
+type CountingBloomFilter struct {
+	counters      []uint8
+	hashFunctions []hashFunction
+	numCounters   uint32
+	hasher        Hasher
+}
+
+func NewCountingBloomFilter(n uint32, fpRate float64, seed uint32) *CountingBloomFilter {
+	numCounters, k := optimalParameters(n, fpRate)
+	return &CountingBloomFilter{
+		counters:      make([]uint8, numCounters),
+		hashFunctions: initHashFunctions(k, numCounters),
+		numCounters:   numCounters,
+		hasher:        murmurFNVHasher{seed: seed},
+	}
+}
+
+func (c *CountingBloomFilter) Insert(value string) {
+	for _, p := range hashPositions(nil, stringBytes(value), c.hasher, c.hashFunctions) {
+		if c.counters[p] < math.MaxUint8 {
+			c.counters[p]++
+		}
+	}
+}
+
+// Remove decrements the counters of value and reports whether it was present.
+// Removing a key that was never inserted would corrupt other keys, so absent
+// keys are ignored; a false positive can still be removed by mistake.
+func (c *CountingBloomFilter) Remove(value string) bool {
+	if !c.Contains(value) {
+		return false
+	}
+	for _, p := range hashPositions(nil, stringBytes(value), c.hasher, c.hashFunctions) {
+		if c.counters[p] < math.MaxUint8 {
+			c.counters[p]--
+		}
+	}
+	return true
+}
+
+func (c *CountingBloomFilter) Contains(value string) bool {
+	for _, p := range hashPositions(nil, stringBytes(value), c.hasher, c.hashFunctions) {
+		if c.counters[p] == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package bloomfilter
+
+import "math"
+
+const (
+	// scalableGrowth multiplies the capacity of each new stage.
+	scalableGrowth = 2
+	// scalableTightening multiplies the false-positive rate of each new stage,
+	// so the compounded rate converges to fpRate / (1 - scalableTightening).
+	scalableTightening = 0.5
+)
+
+// ScalableBloomFilter grows by adding stages instead of letting the
+// false-positive rate climb once the expected cardinality is exceeded. Inserts
+// go to the newest stage; when its fill ratio reaches the optimal 0.5 a larger
+// stage with a tighter rate is appended.
+type ScalableBloomFilter struct {
+	stages     []*BloomFilter
+	stageRates []float64
+	setBits    uint32
+	seed       uint32
+}
+
+func NewScalableBloomFilter(initialCapacity uint32, fpRate float64, seed uint32) *ScalableBloomFilter {
+	if initialCapacity == 0 {
+		initialCapacity = 1
+	}
+	s := &ScalableBloomFilter{seed: seed}
+	s.addStage(initialCapacity, fpRate)
+	return s
+}
+
+func (s *ScalableBloomFilter) Insert(value string) {
+	stage := s.stages[len(s.stages)-1]
+	if float64(s.setBits)/float64(stage.numBits) >= stage.OptimalFillRatio() {
+		capacity := stage.maxSize
+		if capacity <= math.MaxUint32/scalableGrowth {
+			capacity *= scalableGrowth
+		}
+		s.addStage(capacity, s.stageRates[len(s.stageRates)-1]*scalableTightening)
+		stage = s.stages[len(s.stages)-1]
+	}
+
+	for _, p := range stage.key2Positions(stringBytes(value)) {
+		if !readBit(stage.bitsArray, p) {
+			writeBit(stage.bitsArray, p)
+			s.setBits++
+		}
+	}
+	stage.count++
+}
+
+func (s *ScalableBloomFilter) Contains(value string) bool {
+	for _, stage := range s.stages {
+		if stage.Contains(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stages returns the number of stages allocated so far.
+func (s *ScalableBloomFilter) Stages() int {
+	return len(s.stages)
+}
+
+// FalsePositiveRate returns the compounded target rate 1 - Π(1 - p_i) over
+// the stages allocated so far. It stays below fpRate / (1 - 0.5).
+func (s *ScalableBloomFilter) FalsePositiveRate() float64 {
+	none := 1.0
+	for _, p := range s.stageRates {
+		none *= 1 - p
+	}
+	return 1 - none
+}
+
+func (s *ScalableBloomFilter) addStage(capacity uint32, fpRate float64) {
+	s.stages = append(s.stages, NewBloomFilter(capacity, fpRate, s.seed))
+	s.stageRates = append(s.stageRates, fpRate)
+	s.setBits = 0
+}
@@ -0,0 +1,73 @@
+package bloomfilter
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// ShardedBloomFilter routes keys to one of several sub-filters. Each shard has
+// its own lock, so writers to different shards do not contend.
+type ShardedBloomFilter struct {
+	shards    []*BloomFilter
+	locks     []sync.RWMutex
+	partition func(key string) int
+}
+
+// NewShardedBloomFilter creates numShards filters sized for n keys each. A nil
+// partition hashes the key with fnv-1a.
+func NewShardedBloomFilter(numShards int, n uint32, fpRate float64, seed uint32, partition func(key string) int) *ShardedBloomFilter {
+	if numShards < 1 {
+		panic("numShards must be positive")
+	}
+	if partition == nil {
+		partition = fnvPartition
+	}
+	s := &ShardedBloomFilter{
+		shards:    make([]*BloomFilter, numShards),
+		locks:     make([]sync.RWMutex, numShards),
+		partition: partition,
+	}
+	for i := range s.shards {
+		s.shards[i] = NewBloomFilter(n, fpRate, seed)
+	}
+	return s
+}
+
+func (s *ShardedBloomFilter) Insert(value string) {
+	i := s.shardIndex(value)
+	s.locks[i].Lock()
+	defer s.locks[i].Unlock()
+	s.shards[i].Insert(value)
+}
+
+func (s *ShardedBloomFilter) Contains(value string) bool {
+	i := s.shardIndex(value)
+	s.locks[i].RLock()
+	defer s.locks[i].RUnlock()
+	return s.shards[i].Contains(value)
+}
+
+// ShardStats returns the fill ratio of every shard.
+func (s *ShardedBloomFilter) ShardStats() []float64 {
+	stats := make([]float64, len(s.shards))
+	for i, shard := range s.shards {
+		s.locks[i].RLock()
+		stats[i] = shard.FillRatio()
+		s.locks[i].RUnlock()
+	}
+	return stats
+}
+
+func (s *ShardedBloomFilter) shardIndex(key string) int {
+	i := s.partition(key) % len(s.shards)
+	if i < 0 {
+		i += len(s.shards)
+	}
+	return i
+}
+
+func fnvPartition(key string) int {
+	f := fnv.New32a()
+	_, _ = f.Write([]byte(key))
+	return int(f.Sum32() & 0x7fffffff)
+}
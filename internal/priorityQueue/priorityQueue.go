@@ -0,0 +1,23 @@
+// Package priorityQueue holds the contract shared by the array-backed and the
+// linked-list-backed queues, so callers can be written once for both.
+package priorityQueue
+
+// Entry is a value together with its priority, as returned by Top and Peek.
+type Entry[T comparable, P any] interface {
+	Value() T
+	Priority() P
+}
+
+// PriorityQueue is implemented by priorityQueueByArray.PriorityQueueOf and
+// priorityQueueByLinkedList.PriorityQueue. E is the implementation's own pair
+// type, so Top and Peek keep returning concrete values. Both accept any
+// comparable element type; float64 priorities are available in both, via
+// PriorityQueueOf[T, float64] for the array-backed queue.
+type PriorityQueue[T comparable, P any, E Entry[T, P]] interface {
+	Insert(element T, priority P) error
+	Top() (E, error)
+	Peek() (E, error)
+	Remove(element T) error
+	Update(element T, priority P) error
+	Len() int
+}
@@ -0,0 +1,66 @@
+package priorityQueueByArray
+
+// BoundedPriorityQueue retains at most capacity elements with the highest
+// priorities. Internally it is a min-ordered queue, so the element to evict
+// is always at the root.
+type BoundedPriorityQueue[T comparable] = BoundedPriorityQueueOf[T, float32]
+
+type BoundedPriorityQueueOf[T comparable, P Priority] struct {
+	queue    *PriorityQueueOf[T, P]
+	capacity int
+}
+
+func NewBoundedPriorityQueue[T comparable](d int, capacity int) *BoundedPriorityQueue[T] {
+	return NewBoundedPriorityQueueOf[T, float32](d, capacity)
+}
+
+func NewBoundedPriorityQueueOf[T comparable, P Priority](d int, capacity int) *BoundedPriorityQueueOf[T, P] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &BoundedPriorityQueueOf[T, P]{
+		queue:    NewMinPriorityQueueOf[T, P](d, capacity),
+		capacity: capacity,
+	}
+}
+
+// InsertEvicting adds element, evicting the current minimum when the queue is
+// full. If the queue is full and priority does not beat the minimum, the new
+// element is rejected and didEvict is false. An element that is already queued
+// has its priority updated in place.
+func (b *BoundedPriorityQueueOf[T, P]) InsertEvicting(element T, priority P) (evicted PairOf[T, P], didEvict bool) {
+	if b.queue.Contains(element) || b.queue.Len() < b.capacity {
+		b.queue.Upsert(element, priority)
+		return evicted, false
+	}
+
+	lowest, _ := b.queue.Peek()
+	if priority <= lowest.priority {
+		return evicted, false
+	}
+
+	evicted, _ = b.queue.Top()
+	_ = b.queue.Insert(element, priority)
+	return evicted, true
+}
+
+func (b *BoundedPriorityQueueOf[T, P]) Insert(element T, priority P) {
+	b.InsertEvicting(element, priority)
+}
+
+// Peek returns the lowest retained pair, i.e. the next eviction candidate.
+func (b *BoundedPriorityQueueOf[T, P]) Peek() (PairOf[T, P], error) {
+	return b.queue.Peek()
+}
+
+func (b *BoundedPriorityQueueOf[T, P]) Contains(element T) bool {
+	return b.queue.Contains(element)
+}
+
+func (b *BoundedPriorityQueueOf[T, P]) Len() int {
+	return b.queue.Len()
+}
+
+func (b *BoundedPriorityQueueOf[T, P]) Cap() int {
+	return b.capacity
+}
@@ -0,0 +1,58 @@
+package priorityQueueByArray
+
+import (
+	"sync"
+)
+
+// ConcurrentPriorityQueue guards a PriorityQueue with a RWMutex. The queue is
+// kept in an unexported field so unsynchronized methods are not promoted.
+type ConcurrentPriorityQueue[T comparable] = ConcurrentPriorityQueueOf[T, float32]
+
+type ConcurrentPriorityQueueOf[T comparable, P Priority] struct {
+	mu    sync.RWMutex
+	queue *PriorityQueueOf[T, P]
+}
+
+func NewConcurrentPriorityQueue[T comparable](d int, capacity int) *ConcurrentPriorityQueue[T] {
+	return NewConcurrentPriorityQueueOf[T, float32](d, capacity)
+}
+
+func NewConcurrentPriorityQueueOf[T comparable, P Priority](d int, capacity int) *ConcurrentPriorityQueueOf[T, P] {
+	return &ConcurrentPriorityQueueOf[T, P]{queue: NewPriorityQueueOf[T, P](d, capacity)}
+}
+
+func (c *ConcurrentPriorityQueueOf[T, P]) Insert(element T, priority P) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.queue.Insert(element, priority)
+}
+
+func (c *ConcurrentPriorityQueueOf[T, P]) Top() (PairOf[T, P], error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.queue.Top()
+}
+
+func (c *ConcurrentPriorityQueueOf[T, P]) Peek() (PairOf[T, P], error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.queue.Peek()
+}
+
+func (c *ConcurrentPriorityQueueOf[T, P]) Remove(element T) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.queue.Remove(element)
+}
+
+func (c *ConcurrentPriorityQueueOf[T, P]) Update(element T, priority P) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.queue.Update(element, priority)
+}
+
+func (c *ConcurrentPriorityQueueOf[T, P]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.queue.Len()
+}
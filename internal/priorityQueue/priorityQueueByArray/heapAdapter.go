@@ -0,0 +1,50 @@
+package priorityQueueByArray
+
+// HeapAdapter exposes a queue as a container/heap heap.Interface. heap.Push
+// and heap.Pop take PairOf values; Swap, Push and Pop keep indexMap in sync,
+// so the queue's own methods stay usable between heap calls.
+type HeapAdapter[T comparable, P Priority] struct {
+	q *PriorityQueueOf[T, P]
+}
+
+// HeapInterface returns an adapter for container/heap, which only knows the
+// binary layout, so the queue is rebuilt with d = 2 first.
+func (q *PriorityQueueOf[T, P]) HeapInterface() *HeapAdapter[T, P] {
+	if q.sizeD != 2 {
+		q.Rebuild(2)
+	}
+	return &HeapAdapter[T, P]{q: q}
+}
+
+func (h *HeapAdapter[T, P]) Len() int {
+	return len(h.q.pairs)
+}
+
+// Less reports whether pair i belongs closer to the top than pair j, which
+// follows the queue's order: higher priority first unless it is a min queue.
+func (h *HeapAdapter[T, P]) Less(i, j int) bool {
+	return h.q.before(h.q.pairs[i], h.q.pairs[j])
+}
+
+func (h *HeapAdapter[T, P]) Swap(i, j int) {
+	h.q.pairs[i], h.q.pairs[j] = h.q.pairs[j], h.q.pairs[i]
+	h.q.indexMap[h.q.pairs[i].value] = i
+	h.q.indexMap[h.q.pairs[j].value] = j
+}
+
+// Push appends x, which must be a PairOf[T, P]. heap.Push cannot return an
+// error, so pushing a value already in the queue panics with ErrElementExists.
+func (h *HeapAdapter[T, P]) Push(x any) {
+	pair := x.(PairOf[T, P])
+	if _, ok := h.q.indexMap[pair.value]; ok {
+		panic(ErrElementExists)
+	}
+	pair = h.q.newPair(pair.value, pair.priority)
+	h.q.indexMap[pair.value] = len(h.q.pairs)
+	h.q.pairs = append(h.q.pairs, pair)
+}
+
+// Pop removes and returns the last pair as a PairOf[T, P].
+func (h *HeapAdapter[T, P]) Pop() any {
+	return h.q.removeLast()
+}
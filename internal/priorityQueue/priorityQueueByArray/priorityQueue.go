@@ -3,42 +3,202 @@ package priorityQueueByArray
 import (
 	"errors"
 	"fmt"
+	"golang.org/x/exp/constraints"
+	"io"
+	"math"
 	"strings"
 )
 
 var (
 	ErrElementNotFound = errors.New("element not found")
 	ErrQueueIsEmpty    = errors.New("queue is empty")
+	ErrElementExists   = errors.New("element already exists")
+)
+
+// Priority is the set of types usable as priorities in PriorityQueueOf.
+type Priority interface {
+	constraints.Integer | constraints.Float
+}
+
+// PriorityQueue and Pair keep the original float32 API; PriorityQueueOf and
+// PairOf accept any numeric priority type.
+type (
+	PriorityQueue[T comparable] = PriorityQueueOf[T, float32]
+	Pair[T comparable]          = PairOf[T, float32]
 )
 
 func NewPriorityQueue[T comparable](d int, capacity int) *PriorityQueue[T] {
+	return NewPriorityQueueOf[T, float32](d, capacity)
+}
+
+// NewMinPriorityQueue returns a queue whose Top yields the lowest priority first.
+func NewMinPriorityQueue[T comparable](d int, capacity int) *PriorityQueue[T] {
+	return NewMinPriorityQueueOf[T, float32](d, capacity)
+}
+
+// NewPriorityQueueTieBreak returns a max queue that orders elements with equal
+// priority by less on their values: if less(a, b), a comes out first.
+func NewPriorityQueueTieBreak[T comparable](d, capacity int, less func(a, b T) bool) *PriorityQueue[T] {
+	q := NewPriorityQueue[T](d, capacity)
+	q.tieLess = less
+	return q
+}
+
+// NewStablePriorityQueue returns a max queue that yields elements with equal
+// priority in insertion order. Update keeps an element's original position in
+// that order.
+func NewStablePriorityQueue[T comparable](d, capacity int) *PriorityQueue[T] {
+	q := NewPriorityQueue[T](d, capacity)
+	q.stable = true
+	return q
+}
+
+func NewPriorityQueueOf[T comparable, P Priority](d int, capacity int) *PriorityQueueOf[T, P] {
 	if d < 2 {
 		d = 2
 	}
 	if capacity < 0 {
 		capacity = 0
 	}
-	return &PriorityQueue[T]{
-		pairs:    make([]Pair[T], 0, capacity),
+	return &PriorityQueueOf[T, P]{
+		pairs:    make([]PairOf[T, P], 0, capacity),
 		sizeD:    d,
 		indexMap: make(map[T]int, capacity),
 	}
 }
 
-type PriorityQueue[T comparable] struct {
-	pairs    []Pair[T]
+func NewMinPriorityQueueOf[T comparable, P Priority](d int, capacity int) *PriorityQueueOf[T, P] {
+	q := NewPriorityQueueOf[T, P](d, capacity)
+	q.minOrder = true
+	return q
+}
+
+// NewFromPairs builds a queue from pairs in O(N) with a single heapify.
+// The slice is copied. If a value occurs more than once, the last pair wins,
+// so indexMap holds exactly one index per distinct value. Pairs get insertion
+// sequence numbers in input order, as if inserted one at a time.
+func NewFromPairs[T comparable, P Priority](d int, pairs []PairOf[T, P]) *PriorityQueueOf[T, P] {
+	q := NewPriorityQueueOf[T, P](d, len(pairs))
+	for _, p := range pairs {
+		if i, ok := q.indexMap[p.value]; ok {
+			q.pairs[i] = q.newPair(p.value, p.priority)
+			continue
+		}
+		q.indexMap[p.value] = len(q.pairs)
+		q.pairs = append(q.pairs, q.newPair(p.value, p.priority))
+	}
+	q.heapify()
+	return q
+}
+
+// FromPairs is NewFromPairs under a shorter name. The input slice is not
+// retained: later changes to it do not affect the queue.
+func FromPairs[T comparable, P Priority](d int, pairs []PairOf[T, P]) *PriorityQueueOf[T, P] {
+	return NewFromPairs(d, pairs)
+}
+
+// SortPairsDesc sorts pairs in place by descending priority using a d-ary
+// heapsort. It does not need a PriorityQueue.
+func SortPairsDesc[T comparable, P Priority](pairs []PairOf[T, P], d int) {
+	if d < 2 {
+		d = 2
+	}
+	n := len(pairs)
+	for i := (n - 2) / d; i >= 0; i-- {
+		siftDownMin(pairs, d, i, n)
+	}
+	for end := n - 1; end > 0; end-- {
+		pairs[0], pairs[end] = pairs[end], pairs[0]
+		siftDownMin(pairs, d, 0, end)
+	}
+}
+
+// SelectTopK reads input until it is closed and returns the k highest-priority
+// pairs in descending order. Memory stays O(k) for any stream length.
+func SelectTopK[T comparable, P Priority](k int, input <-chan PairOf[T, P]) []PairOf[T, P] {
+	if k < 0 {
+		k = 0
+	}
+	heap := make([]PairOf[T, P], 0, k)
+	for p := range input {
+		if len(heap) < k {
+			heap = append(heap, p)
+			siftUpMin(heap, 2, len(heap)-1)
+		} else if k > 0 && p.priority > heap[0].priority {
+			heap[0] = p
+			siftDownMin(heap, 2, 0, len(heap))
+		}
+	}
+	SortPairsDesc(heap, 2)
+	return heap
+}
+
+func siftUpMin[T comparable, P Priority](pairs []PairOf[T, P], d, index int) {
+	for index > 0 {
+		parent := (index - 1) / d
+		if pairs[parent].priority <= pairs[index].priority {
+			return
+		}
+		pairs[index], pairs[parent] = pairs[parent], pairs[index]
+		index = parent
+	}
+}
+
+func siftDownMin[T comparable, P Priority](pairs []PairOf[T, P], d, index, n int) {
+	for {
+		start := index*d + 1
+		if start >= n {
+			return
+		}
+		best := start
+		for i := start + 1; i < start+d && i < n; i++ {
+			if pairs[i].priority < pairs[best].priority {
+				best = i
+			}
+		}
+		if pairs[best].priority >= pairs[index].priority {
+			return
+		}
+		pairs[index], pairs[best] = pairs[best], pairs[index]
+		index = best
+	}
+}
+
+type PriorityQueueOf[T comparable, P Priority] struct {
+	pairs    []PairOf[T, P]
 	sizeD    int
 	indexMap map[T]int
+	minOrder bool
+	tieLess  func(a, b T) bool
+	stable   bool
+	nextSeq  uint64
 }
 
-type Pair[T comparable] struct {
-	priority float32
+type PairOf[T comparable, P Priority] struct {
+	priority P
 	value    T
+	seq      uint64
+}
+
+func NewPair[T comparable](value T, priority float32) Pair[T] {
+	return NewPairOf(value, priority)
 }
 
-func (q *PriorityQueue[T]) Top() (Pair[T], error) {
+func NewPairOf[T comparable, P Priority](value T, priority P) PairOf[T, P] {
+	return PairOf[T, P]{priority: priority, value: value}
+}
+
+func (p PairOf[T, P]) Value() T {
+	return p.value
+}
+
+func (p PairOf[T, P]) Priority() P {
+	return p.priority
+}
+
+func (q *PriorityQueueOf[T, P]) Top() (PairOf[T, P], error) {
 	if q.isEmpty() {
-		return Pair[T]{}, ErrQueueIsEmpty
+		return PairOf[T, P]{}, ErrQueueIsEmpty
 	}
 
 	p := q.removeLast()
@@ -55,22 +215,104 @@ func (q *PriorityQueue[T]) Top() (Pair[T], error) {
 	return element, nil
 }
 
-func (q *PriorityQueue[T]) Peek() (Pair[T], error) {
+// DrainTo sends every pair to ch in Top order, leaving the queue empty.
+// The channel is not closed.
+func (q *PriorityQueueOf[T, P]) DrainTo(ch chan<- PairOf[T, P]) {
+	for !q.isEmpty() {
+		p, _ := q.Top()
+		ch <- p
+	}
+}
+
+// PopBatch removes and returns up to n pairs in Top order. A larger n drains
+// the queue.
+func (q *PriorityQueueOf[T, P]) PopBatch(n int) []PairOf[T, P] {
+	n = max(min(n, len(q.pairs)), 0)
+	batch := make([]PairOf[T, P], 0, n)
+	for len(batch) < n {
+		p, _ := q.Top()
+		batch = append(batch, p)
+	}
+	return batch
+}
+
+func (q *PriorityQueueOf[T, P]) Peek() (PairOf[T, P], error) {
 	if q.isEmpty() {
-		return Pair[T]{}, ErrQueueIsEmpty
+		return PairOf[T, P]{}, ErrQueueIsEmpty
 	}
 
 	return q.pairs[0], nil
 }
 
-func (q *PriorityQueue[T]) Insert(element T, priority float32) {
-	newPair := Pair[T]{value: element, priority: priority}
-	q.pairs = append(q.pairs, newPair)
+// PeekTopK returns up to k pairs in Top order without modifying the queue.
+func (q *PriorityQueueOf[T, P]) PeekTopK(k int) []PairOf[T, P] {
+	if k <= 0 || q.isEmpty() {
+		return []PairOf[T, P]{}
+	}
+	if k > len(q.pairs) {
+		k = len(q.pairs)
+	}
+
+	result := make([]PairOf[T, P], 0, k)
+	q.walk(k*q.sizeD, func(p PairOf[T, P]) bool {
+		result = append(result, p)
+		return len(result) < k
+	})
+	return result
+}
+
+// ToSortedSlice returns every pair in Top order without modifying the queue.
+func (q *PriorityQueueOf[T, P]) ToSortedSlice() []PairOf[T, P] {
+	return q.PeekTopK(len(q.pairs))
+}
+
+// Each visits elements in Top order until fn returns false. The order of
+// elements with equal priority is unspecified. The queue is not modified.
+func (q *PriorityQueueOf[T, P]) Each(fn func(value T, priority P) bool) {
+	q.walk(len(q.pairs), func(p PairOf[T, P]) bool {
+		return fn(p.value, p.priority)
+	})
+}
+
+// walk yields pairs in Top order. Candidates are tracked in a scratch heap of
+// indices into q.pairs, so visiting k pairs costs O(k*d*log k) regardless of
+// the queue size.
+func (q *PriorityQueueOf[T, P]) walk(capacity int, fn func(PairOf[T, P]) bool) {
+	if q.isEmpty() {
+		return
+	}
+
+	scratch := NewPriorityQueueOf[int, P](q.sizeD, capacity)
+	scratch.minOrder = q.minOrder
+	if q.stable || q.tieLess != nil {
+		scratch.tieLess = func(a, b int) bool { return q.before(q.pairs[a], q.pairs[b]) }
+	}
+	_ = scratch.Insert(0, q.pairs[0].priority)
+	for !scratch.isEmpty() {
+		top, _ := scratch.Top()
+		index := top.value
+		if !fn(q.pairs[index]) {
+			return
+		}
+
+		start := index*q.sizeD + 1
+		for child := start; child < start+q.sizeD && child < len(q.pairs); child++ {
+			_ = scratch.Insert(child, q.pairs[child].priority)
+		}
+	}
+}
+
+func (q *PriorityQueueOf[T, P]) Insert(element T, priority P) error {
+	if _, ok := q.indexMap[element]; ok {
+		return ErrElementExists
+	}
+	q.pairs = append(q.pairs, q.newPair(element, priority))
 	q.indexMap[element] = len(q.pairs) - 1
 	q.bubbleUp()
+	return nil
 }
 
-func (q *PriorityQueue[T]) Remove(element T) error {
+func (q *PriorityQueueOf[T, P]) Remove(element T) error {
 	index, ok := q.indexMap[element]
 	if !ok {
 		return ErrElementNotFound
@@ -83,43 +325,233 @@ func (q *PriorityQueue[T]) Remove(element T) error {
 		return nil
 	}
 
-	removedElement := q.pairs[index].value
-	removedPriority := q.pairs[index].priority
+	removed := q.pairs[index]
 
 	q.pairs[index] = q.pairs[lastIndex]
 	q.indexMap[q.pairs[index].value] = index
 
 	q.pairs = q.pairs[:lastIndex]
-	delete(q.indexMap, removedElement)
+	delete(q.indexMap, removed.value)
 
-	if q.pairs[index].priority < removedPriority {
+	if q.before(q.pairs[index], removed) {
 		q.bubbleUpIndex(index)
-	} else if q.pairs[index].priority > removedPriority {
+	} else if q.before(removed, q.pairs[index]) {
 		q.pushDownIndex(index)
 	}
 
 	return nil
 }
 
-func (q *PriorityQueue[T]) Update(element T, newPriority float32) error {
+// Discard removes element if present and reports whether it did. Unlike
+// Remove it never fails.
+func (q *PriorityQueueOf[T, P]) Discard(element T) bool {
+	return q.Remove(element) == nil
+}
+
+func (q *PriorityQueueOf[T, P]) Update(element T, newPriority P) error {
+	index, ok := q.indexMap[element]
+	if !ok {
+		return ErrElementNotFound
+	}
+
+	q.updateIndex(index, newPriority)
+	return nil
+}
+
+func (q *PriorityQueueOf[T, P]) Upsert(element T, priority P) {
+	if index, ok := q.indexMap[element]; ok {
+		q.updateIndex(index, priority)
+		return
+	}
+
+	q.pairs = append(q.pairs, q.newPair(element, priority))
+	q.indexMap[element] = len(q.pairs) - 1
+	q.bubbleUp()
+}
+
+// Adjust adds delta to the priority of element and restores the heap order.
+func (q *PriorityQueueOf[T, P]) Adjust(element T, delta P) error {
 	index, ok := q.indexMap[element]
 	if !ok {
 		return ErrElementNotFound
 	}
+	q.updateIndex(index, q.pairs[index].priority+delta)
+	return nil
+}
 
-	oldPriority := q.pairs[index].priority
+func (q *PriorityQueueOf[T, P]) SwapPriorities(a, b T) error {
+	indexA, ok := q.indexMap[a]
+	if !ok {
+		return ErrElementNotFound
+	}
+	indexB, ok := q.indexMap[b]
+	if !ok {
+		return ErrElementNotFound
+	}
+
+	priorityA := q.pairs[indexA].priority
+	q.updateIndex(indexA, q.pairs[indexB].priority)
+	q.updateIndex(q.indexMap[b], priorityA)
+	return nil
+}
+
+func (q *PriorityQueueOf[T, P]) updateIndex(index int, newPriority P) {
+	old := q.pairs[index]
 	q.pairs[index].priority = newPriority
 
-	if newPriority < oldPriority {
+	if q.before(q.pairs[index], old) {
 		q.bubbleUpIndex(index)
-	} else if newPriority > oldPriority {
+	} else if q.before(old, q.pairs[index]) {
 		q.pushDownIndex(index)
 	}
+}
 
+func (q *PriorityQueueOf[T, P]) Contains(element T) bool {
+	_, ok := q.indexMap[element]
+	return ok
+}
+
+func (q *PriorityQueueOf[T, P]) PriorityOf(element T) (P, error) {
+	index, ok := q.indexMap[element]
+	if !ok {
+		return 0, ErrElementNotFound
+	}
+	return q.pairs[index].priority, nil
+}
+
+func (q *PriorityQueueOf[T, P]) Len() int {
+	return len(q.pairs)
+}
+
+// Depth returns the number of levels in the heap: 0 when empty, 1 for a single
+// element. It is computed in O(1) from Len and d alone, as the smallest L with
+// (d^L-1)/(d-1) >= n, i.e. L = ceil(log_d(n*(d-1)+1)).
+func (q *PriorityQueueOf[T, P]) Depth() int {
+	n := len(q.pairs)
+	if n == 0 {
+		return 0
+	}
+	d := float64(q.sizeD)
+	target := float64(n)*(d-1) + 1
+	depth := int(math.Ceil(math.Log(target) / math.Log(d)))
+	// The logarithm can round across an exact power of d; powers of d are
+	// exact in float64 here, so check the neighbours directly.
+	switch {
+	case math.Pow(d, float64(depth-1)) >= target:
+		depth--
+	case math.Pow(d, float64(depth)) < target:
+		depth++
+	}
+	return depth
+}
+
+func (q *PriorityQueueOf[T, P]) Clear() {
+	clear(q.pairs)
+	q.pairs = q.pairs[:0]
+	clear(q.indexMap)
+}
+
+func (q *PriorityQueueOf[T, P]) Clone() *PriorityQueueOf[T, P] {
+	c := &PriorityQueueOf[T, P]{
+		pairs:    make([]PairOf[T, P], len(q.pairs), cap(q.pairs)),
+		sizeD:    q.sizeD,
+		indexMap: make(map[T]int, len(q.pairs)),
+		minOrder: q.minOrder,
+		tieLess:  q.tieLess,
+		stable:   q.stable,
+		nextSeq:  q.nextSeq,
+	}
+	copy(c.pairs, q.pairs)
+	for i, pair := range c.pairs {
+		c.indexMap[pair.value] = i
+	}
+	return c
+}
+
+// Merge appends other's pairs into q and re-heapifies in O(N+M) using q's
+// arity and order. Values present in both queues are rejected with
+// ErrElementExists and leave q unchanged. other is not modified.
+func (q *PriorityQueueOf[T, P]) Merge(other *PriorityQueueOf[T, P]) error {
+	for _, pair := range other.pairs {
+		if _, ok := q.indexMap[pair.value]; ok {
+			return ErrElementExists
+		}
+	}
+
+	for _, pair := range other.pairs {
+		pair.seq += q.nextSeq
+		q.pairs = append(q.pairs, pair)
+	}
+	q.nextSeq += other.nextSeq
+	q.heapify()
 	return nil
 }
 
-func (q *PriorityQueue[T]) heapify() {
+// Decay multiplies every priority by factor in place. A positive factor never
+// reverses two priorities, so the heap is rebuilt only for factor <= 0 and,
+// since integer priorities are truncated toward zero and may become equal,
+// when ties are broken in stable mode or by a tie-break function. A NaN
+// factor is ignored, as it would turn every priority into NaN.
+func (q *PriorityQueueOf[T, P]) Decay(factor float32) {
+	if math.IsNaN(float64(factor)) {
+		return
+	}
+	for i := range q.pairs {
+		q.pairs[i].priority = P(float64(q.pairs[i].priority) * float64(factor))
+	}
+	if factor <= 0 || q.stable || q.tieLess != nil {
+		q.heapify()
+	}
+}
+
+// Rebuild changes the branching factor and restores the heap in O(N).
+func (q *PriorityQueueOf[T, P]) Rebuild(newD int) {
+	if newD < 2 {
+		newD = 2
+	}
+	q.sizeD = newD
+	q.heapify()
+}
+
+// SubtreeSlice returns the pairs in the subtree rooted at index, in level
+// order. It is meant for inspection in tests.
+func (q *PriorityQueueOf[T, P]) SubtreeSlice(index int) []PairOf[T, P] {
+	result := make([]PairOf[T, P], 0)
+	if index < 0 || index >= len(q.pairs) {
+		return result
+	}
+	for start, end := index, index+1; start < len(q.pairs); start, end = start*q.sizeD+1, end*q.sizeD+1 {
+		if end > len(q.pairs) {
+			end = len(q.pairs)
+		}
+		result = append(result, q.pairs[start:end]...)
+	}
+	return result
+}
+
+// ValidateHeap checks the heap order and indexMap consistency and reports the
+// first violating index.
+func (q *PriorityQueueOf[T, P]) ValidateHeap() error {
+	if len(q.indexMap) != len(q.pairs) {
+		return fmt.Errorf("indexMap has %d entries for %d pairs", len(q.indexMap), len(q.pairs))
+	}
+	for i, pair := range q.pairs {
+		if index, ok := q.indexMap[pair.value]; !ok || index != i {
+			return fmt.Errorf("indexMap[%v]=%d at index %d", pair.value, index, i)
+		}
+		if i == 0 {
+			continue
+		}
+		parent := q.getParentIndex(i)
+		if q.before(pair, q.pairs[parent]) {
+			return fmt.Errorf("heap violated at index %d: priority %v, parent %d has %v",
+				i, pair.priority, parent, q.pairs[parent].priority)
+		}
+	}
+	return nil
+}
+
+func (q *PriorityQueueOf[T, P]) heapify() {
 	q.indexMap = make(map[T]int, len(q.pairs))
 	for i, pair := range q.pairs {
 		q.indexMap[pair.value] = i
@@ -130,15 +562,15 @@ func (q *PriorityQueue[T]) heapify() {
 	}
 }
 
-func (q *PriorityQueue[T]) bubbleUp() {
+func (q *PriorityQueueOf[T, P]) bubbleUp() {
 	q.bubbleUpIndex(len(q.pairs) - 1)
 }
 
-func (q *PriorityQueue[T]) bubbleUpIndex(index int) {
+func (q *PriorityQueueOf[T, P]) bubbleUpIndex(index int) {
 	current := q.pairs[index]
 	for index > 0 {
 		parentIndex := q.getParentIndex(index)
-		if q.pairs[parentIndex].priority < current.priority {
+		if q.before(current, q.pairs[parentIndex]) {
 			q.pairs[index] = q.pairs[parentIndex]
 			q.indexMap[q.pairs[index].value] = index
 			index = parentIndex
@@ -150,17 +582,17 @@ func (q *PriorityQueue[T]) bubbleUpIndex(index int) {
 	q.indexMap[current.value] = index
 }
 
-func (q *PriorityQueue[T]) pushDown() {
+func (q *PriorityQueueOf[T, P]) pushDown() {
 	q.pushDownIndex(0)
 }
 
-func (q *PriorityQueue[T]) pushDownIndex(currentIndex int) {
+func (q *PriorityQueueOf[T, P]) pushDownIndex(currentIndex int) {
 	for currentIndex < q.firstLeafIndex() {
 		_, childIndex := q.highestPriorityChild(currentIndex)
 		if childIndex == -1 {
 			break
 		}
-		if q.pairs[childIndex].priority > q.pairs[currentIndex].priority {
+		if q.before(q.pairs[childIndex], q.pairs[currentIndex]) {
 			q.pairs[currentIndex], q.pairs[childIndex] = q.pairs[childIndex], q.pairs[currentIndex]
 			q.indexMap[q.pairs[currentIndex].value] = currentIndex
 			q.indexMap[q.pairs[childIndex].value] = childIndex
@@ -171,29 +603,55 @@ func (q *PriorityQueue[T]) pushDownIndex(currentIndex int) {
 	}
 }
 
-func (q *PriorityQueue[T]) getParentIndex(parentIndex int) int {
+func (q *PriorityQueueOf[T, P]) higher(a, b P) bool {
+	if q.minOrder {
+		return a < b
+	}
+	return a > b
+}
+
+// before reports whether a should be closer to the top than b. Equal
+// priorities are ordered by insertion sequence in stable mode, otherwise by
+// tieLess when set.
+func (q *PriorityQueueOf[T, P]) before(a, b PairOf[T, P]) bool {
+	if a.priority == b.priority {
+		if q.stable {
+			return a.seq < b.seq
+		}
+		return q.tieLess != nil && q.tieLess(a.value, b.value)
+	}
+	return q.higher(a.priority, b.priority)
+}
+
+// newPair stamps the pair with the next insertion sequence number.
+func (q *PriorityQueueOf[T, P]) newPair(element T, priority P) PairOf[T, P] {
+	q.nextSeq++
+	return PairOf[T, P]{value: element, priority: priority, seq: q.nextSeq}
+}
+
+func (q *PriorityQueueOf[T, P]) getParentIndex(parentIndex int) int {
 	return (parentIndex - 1) / q.sizeD
 }
 
-func (q *PriorityQueue[T]) firstLeafIndex() int {
+func (q *PriorityQueueOf[T, P]) firstLeafIndex() int {
 	return (len(q.pairs)-2)/q.sizeD + 1
 }
 
-func (q *PriorityQueue[T]) isEmpty() bool {
+func (q *PriorityQueueOf[T, P]) isEmpty() bool {
 	return len(q.pairs) == 0
 }
 
-func (q *PriorityQueue[T]) removeLast() Pair[T] {
+func (q *PriorityQueueOf[T, P]) removeLast() PairOf[T, P] {
 	element := q.pairs[len(q.pairs)-1]
 	delete(q.indexMap, element.value)
 	q.pairs = q.pairs[:len(q.pairs)-1]
 	return element
 }
 
-func (q *PriorityQueue[T]) highestPriorityChild(currentIndex int) (best Pair[T], bestIdx int) {
+func (q *PriorityQueueOf[T, P]) highestPriorityChild(currentIndex int) (best PairOf[T, P], bestIdx int) {
 	start := currentIndex*q.sizeD + 1
 	if start >= len(q.pairs) {
-		return Pair[T]{}, -1
+		return PairOf[T, P]{}, -1
 	}
 	end := start + q.sizeD - 1
 	if end >= len(q.pairs) {
@@ -203,7 +661,7 @@ func (q *PriorityQueue[T]) highestPriorityChild(currentIndex int) (best Pair[T],
 	bestIdx = start
 	best = q.pairs[start]
 	for i := start + 1; i <= end; i++ {
-		if q.pairs[i].priority > best.priority {
+		if q.before(q.pairs[i], best) {
 			best = q.pairs[i]
 			bestIdx = i
 		}
@@ -211,13 +669,23 @@ func (q *PriorityQueue[T]) highestPriorityChild(currentIndex int) (best Pair[T],
 	return best, bestIdx
 }
 
-func (q *PriorityQueue[T]) AsciiTree() string {
+func (q *PriorityQueueOf[T, P]) AsciiTree() string {
 	var b strings.Builder
+	_ = q.WriteAsciiTree(&b)
+	return b.String()
+}
+
+// WriteAsciiTree streams the AsciiTree rendering to w line by line and returns
+// the first write error.
+func (q *PriorityQueueOf[T, P]) WriteAsciiTree(w io.Writer) error {
 	n := len(q.pairs)
 	if n == 0 {
-		return "(empty)\n"
+		_, err := io.WriteString(w, "(empty)\n")
+		return err
+	}
+	if _, err := io.WriteString(w, q.nodeLabel(0)+"\n"); err != nil {
+		return err
 	}
-	b.WriteString(q.nodeLabel(0) + "\n")
 	start := 0*q.sizeD + 1
 	end := start + q.sizeD
 	if end > n {
@@ -225,24 +693,28 @@ func (q *PriorityQueue[T]) AsciiTree() string {
 	}
 	for i := start; i < end; i++ {
 		last := i == end-1
-		q.asciiTree(i, "", last, &b)
+		if err := q.asciiTree(i, "", last, w); err != nil {
+			return err
+		}
 	}
-	return b.String()
+	return nil
 }
 
-func (q *PriorityQueue[T]) asciiTree(i int, prefix string, isLast bool, b *strings.Builder) {
+func (q *PriorityQueueOf[T, P]) asciiTree(i int, prefix string, isLast bool, w io.Writer) error {
 	connector := "├── "
 	childPrefix := prefix + "│   "
 	if isLast {
 		connector = "└── "
 		childPrefix = prefix + "    "
 	}
-	b.WriteString(prefix + connector + q.nodeLabel(i) + "\n")
+	if _, err := io.WriteString(w, prefix+connector+q.nodeLabel(i)+"\n"); err != nil {
+		return err
+	}
 
 	n := len(q.pairs)
 	start := i*q.sizeD + 1
 	if start >= n {
-		return
+		return nil
 	}
 	end := start + q.sizeD
 	if end > n {
@@ -250,11 +722,14 @@ func (q *PriorityQueue[T]) asciiTree(i int, prefix string, isLast bool, b *strin
 	}
 	for j := start; j < end; j++ {
 		last := j == end-1
-		q.asciiTree(j, childPrefix, last, b)
+		if err := q.asciiTree(j, childPrefix, last, w); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
-func (q *PriorityQueue[T]) nodeLabel(i int) string {
+func (q *PriorityQueueOf[T, P]) nodeLabel(i int) string {
 	p := q.pairs[i]
-	return fmt.Sprintf("[%.1f] %v", p.priority, p.value)
+	return fmt.Sprintf("[%.1f] %v", float64(p.priority), p.value)
 }
@@ -0,0 +1,70 @@
+package priorityQueueByArray
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+)
+
+type pairJSON[T comparable, P Priority] struct {
+	Value    T `json:"value"`
+	Priority P `json:"priority"`
+}
+
+type priorityQueueJSON[T comparable, P Priority] struct {
+	D      int              `json:"d"`
+	Min    bool             `json:"min,omitempty"`
+	Stable bool             `json:"stable,omitempty"`
+	Pairs  []pairJSON[T, P] `json:"pairs"`
+}
+
+// MarshalJSON writes the pairs in insertion order, so that UnmarshalJSON can
+// restore the sequence numbers a stable queue uses to break ties. A tie-break
+// function is not encoded.
+func (q *PriorityQueueOf[T, P]) MarshalJSON() ([]byte, error) {
+	pairs := slices.Clone(q.pairs)
+	slices.SortFunc(pairs, func(a, b PairOf[T, P]) int { return cmp.Compare(a.seq, b.seq) })
+
+	out := priorityQueueJSON[T, P]{
+		D:      q.sizeD,
+		Min:    q.minOrder,
+		Stable: q.stable,
+		Pairs:  make([]pairJSON[T, P], len(pairs)),
+	}
+	for i, p := range pairs {
+		out.Pairs[i] = pairJSON[T, P]{Value: p.value, Priority: p.priority}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON replaces the queue's contents, stamping the pairs with fresh
+// sequence numbers in input order.
+func (q *PriorityQueueOf[T, P]) UnmarshalJSON(data []byte) error {
+	var in priorityQueueJSON[T, P]
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	seen := make(map[T]struct{}, len(in.Pairs))
+	for _, p := range in.Pairs {
+		if _, ok := seen[p.Value]; ok {
+			return ErrElementExists
+		}
+		seen[p.Value] = struct{}{}
+	}
+	q.nextSeq = 0
+	pairs := make([]PairOf[T, P], 0, len(in.Pairs))
+	for _, p := range in.Pairs {
+		pairs = append(pairs, q.newPair(p.Value, p.Priority))
+	}
+
+	if in.D < 2 {
+		in.D = 2
+	}
+	q.sizeD = in.D
+	q.minOrder = in.Min
+	q.stable = in.Stable
+	q.pairs = pairs
+	q.heapify()
+	return nil
+}
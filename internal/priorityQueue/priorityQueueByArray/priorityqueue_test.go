@@ -0,0 +1,1413 @@
+package priorityQueueByArray
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func checkHeap[T comparable](t *testing.T, q *PriorityQueue[T]) {
+	t.Helper()
+
+	if err := q.ValidateHeap(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTopReturnsMaxByDefault(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[string](3, 0)
+	q.Insert("low", 1)
+	q.Insert("high", 10)
+	q.Insert("mid", 5)
+
+	for _, want := range []string{"high", "mid", "low"} {
+		got, err := q.Top()
+		if err != nil {
+			t.Fatalf("Top: %v", err)
+		}
+		if got.value != want {
+			t.Fatalf("Top=%q, want=%q", got.value, want)
+		}
+	}
+	if _, err := q.Top(); err != ErrQueueIsEmpty {
+		t.Fatalf("Top on empty: err=%v, want=%v", err, ErrQueueIsEmpty)
+	}
+}
+
+func TestMinPriorityQueueTopReturnsMin(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(1))
+	q := NewMinPriorityQueue[int](4, 0)
+	for i := 0; i < 200; i++ {
+		q.Insert(i, float32(rng.Intn(1000)))
+	}
+	checkHeap(t, q)
+
+	prev := float32(-1)
+	for i := 0; i < 200; i++ {
+		p, err := q.Top()
+		if err != nil {
+			t.Fatalf("Top: %v", err)
+		}
+		if p.priority < prev {
+			t.Fatalf("min order violated: %v after %v", p.priority, prev)
+		}
+		prev = p.priority
+	}
+}
+
+func TestMinPriorityQueueUpdateAndRemove(t *testing.T) {
+	t.Parallel()
+
+	q := NewMinPriorityQueue[string](2, 0)
+	for i := 0; i < 20; i++ {
+		q.Insert(fmt.Sprintf("v%d", i), float32(i))
+	}
+
+	if err := q.Update("v15", -1); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	checkHeap(t, q)
+	if err := q.Update("v0", 100); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	checkHeap(t, q)
+	if err := q.Remove("v7"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	checkHeap(t, q)
+
+	top, _ := q.Peek()
+	if top.value != "v15" {
+		t.Fatalf("Peek=%q, want=%q", top.value, "v15")
+	}
+	if tree := q.AsciiTree(); tree == "" || tree == "(empty)\n" {
+		t.Fatalf("unexpected AsciiTree output %q", tree)
+	}
+}
+
+func TestUpdateAndRemoveKeepMaxHeap(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(2))
+	q := NewPriorityQueue[int](3, 0)
+	for i := 0; i < 100; i++ {
+		q.Insert(i, float32(rng.Intn(100)))
+	}
+	for i := 0; i < 100; i += 3 {
+		if err := q.Update(i, float32(rng.Intn(100))); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		checkHeap(t, q)
+	}
+	for i := 1; i < 100; i += 4 {
+		if err := q.Remove(i); err != nil {
+			t.Fatalf("Remove: %v", err)
+		}
+		checkHeap(t, q)
+	}
+	if err := q.Remove(1); err != ErrElementNotFound {
+		t.Fatalf("Remove absent: err=%v, want=%v", err, ErrElementNotFound)
+	}
+}
+
+func TestNewFromPairsBuildsValidHeap(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(3))
+	pairs := make([]Pair[int], 0, 500)
+	for i := 0; i < 500; i++ {
+		pairs = append(pairs, NewPair(i, float32(rng.Intn(1000))))
+	}
+
+	q := NewFromPairs(3, pairs)
+	checkHeap(t, q)
+	if len(q.pairs) != len(pairs) {
+		t.Fatalf("len=%d, want=%d", len(q.pairs), len(pairs))
+	}
+
+	prev, _ := q.Top()
+	for len(q.pairs) > 0 {
+		p, _ := q.Top()
+		if p.Priority() > prev.Priority() {
+			t.Fatalf("order violated: %v after %v", p.Priority(), prev.Priority())
+		}
+		prev = p
+	}
+}
+
+func TestNewFromPairsDuplicatesLastWins(t *testing.T) {
+	t.Parallel()
+
+	q := NewFromPairs(2, []Pair[string]{
+		NewPair("a", 1),
+		NewPair("b", 2),
+		NewPair("a", 5),
+	})
+	checkHeap(t, q)
+
+	if len(q.pairs) != 2 {
+		t.Fatalf("len=%d, want=2", len(q.pairs))
+	}
+	top, _ := q.Peek()
+	if top.Value() != "a" || top.Priority() != 5 {
+		t.Fatalf("Peek=%v/%v, want=a/5", top.Value(), top.Priority())
+	}
+}
+
+func benchmarkPairs(n int) []Pair[int] {
+	rng := rand.New(rand.NewSource(42))
+	pairs := make([]Pair[int], n)
+	for i := range pairs {
+		pairs[i] = NewPair(i, rng.Float32())
+	}
+	return pairs
+}
+
+func BenchmarkNewFromPairs(b *testing.B) {
+	pairs := benchmarkPairs(100_000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = NewFromPairs(4, pairs)
+	}
+}
+
+func BenchmarkRepeatedInsert(b *testing.B) {
+	pairs := benchmarkPairs(100_000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := NewPriorityQueue[int](4, len(pairs))
+		for _, p := range pairs {
+			q.Insert(p.value, p.priority)
+		}
+	}
+}
+
+func TestFromPairsDoesNotAliasInput(t *testing.T) {
+	t.Parallel()
+
+	pairs := []Pair[string]{NewPair("a", 1), NewPair("b", 2), NewPair("c", 3)}
+	q := FromPairs(2, pairs)
+
+	for i := range pairs {
+		pairs[i] = NewPair("x", 100)
+	}
+	pairs = append(pairs[:0], NewPair("y", 200))
+
+	checkHeap(t, q)
+	for _, want := range []string{"c", "b", "a"} {
+		got, err := q.Top()
+		if err != nil {
+			t.Fatalf("Top: %v", err)
+		}
+		if got.Value() != want {
+			t.Fatalf("Top=%q, want=%q", got.Value(), want)
+		}
+	}
+}
+
+func TestInsertRejectsDuplicates(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[string](2, 0)
+	if err := q.Insert("task", 1); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if err := q.Insert("other", 3); err != nil {
+		t.Fatalf("Insert: %v", err)
+	}
+	if err := q.Insert("task", 5); err != ErrElementExists {
+		t.Fatalf("duplicate Insert: err=%v, want=%v", err, ErrElementExists)
+	}
+	checkHeap(t, q)
+
+	top, _ := q.Peek()
+	if top.Value() != "other" {
+		t.Fatalf("duplicate changed heap: Peek=%q", top.Value())
+	}
+
+	if err := q.Update("task", 10); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	checkHeap(t, q)
+	if err := q.Remove("task"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	checkHeap(t, q)
+	if err := q.Remove("task"); err != ErrElementNotFound {
+		t.Fatalf("second Remove: err=%v, want=%v", err, ErrElementNotFound)
+	}
+	if err := q.Insert("task", 7); err != nil {
+		t.Fatalf("Insert after Remove: %v", err)
+	}
+	checkHeap(t, q)
+}
+
+func TestContainsAndPriorityOf(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[string](3, 0)
+	for i := 0; i < 10; i++ {
+		_ = q.Insert(fmt.Sprintf("v%d", i), float32(i))
+	}
+	_ = q.Remove("v3")
+	_, _ = q.Top()
+	_ = q.Update("v5", 42)
+
+	for _, absent := range []string{"v3", "v9", "nope"} {
+		if q.Contains(absent) {
+			t.Fatalf("Contains(%q)=true, want false", absent)
+		}
+		if _, err := q.PriorityOf(absent); err != ErrElementNotFound {
+			t.Fatalf("PriorityOf(%q): err=%v, want=%v", absent, err, ErrElementNotFound)
+		}
+	}
+
+	want := map[string]float32{"v0": 0, "v4": 4, "v5": 42, "v8": 8}
+	for v, p := range want {
+		if !q.Contains(v) {
+			t.Fatalf("Contains(%q)=false, want true", v)
+		}
+		got, err := q.PriorityOf(v)
+		if err != nil {
+			t.Fatalf("PriorityOf(%q): %v", v, err)
+		}
+		if got != p {
+			t.Fatalf("PriorityOf(%q)=%v, want=%v", v, got, p)
+		}
+	}
+}
+
+func TestUpsertInsertsAndUpdates(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[string](2, 0)
+	q.Upsert("a", 1)
+	q.Upsert("b", 2)
+	q.Upsert("c", 3)
+	checkHeap(t, q)
+	if len(q.pairs) != 3 {
+		t.Fatalf("len=%d, want=3", len(q.pairs))
+	}
+
+	q.Upsert("a", 10)
+	checkHeap(t, q)
+	if top, _ := q.Peek(); top.Value() != "a" {
+		t.Fatalf("Peek=%q after raising a, want a", top.Value())
+	}
+
+	q.Upsert("a", 0)
+	checkHeap(t, q)
+	if top, _ := q.Peek(); top.Value() != "c" {
+		t.Fatalf("Peek=%q after lowering a, want c", top.Value())
+	}
+	if len(q.pairs) != 3 {
+		t.Fatalf("len=%d after updates, want=3", len(q.pairs))
+	}
+	if p, _ := q.PriorityOf("a"); p != 0 {
+		t.Fatalf("PriorityOf(a)=%v, want=0", p)
+	}
+}
+
+func TestSwapPriorities(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[int](3, 0)
+	for i := 0; i < 30; i++ {
+		_ = q.Insert(i, float32(i))
+	}
+
+	if err := q.SwapPriorities(0, 29); err != nil {
+		t.Fatalf("SwapPriorities: %v", err)
+	}
+	checkHeap(t, q)
+	if p, _ := q.PriorityOf(0); p != 29 {
+		t.Fatalf("PriorityOf(0)=%v, want=29", p)
+	}
+	if p, _ := q.PriorityOf(29); p != 0 {
+		t.Fatalf("PriorityOf(29)=%v, want=0", p)
+	}
+	if top, _ := q.Peek(); top.Value() != 0 {
+		t.Fatalf("Peek=%v, want=0", top.Value())
+	}
+
+	if err := q.SwapPriorities(10, 12); err != nil {
+		t.Fatalf("SwapPriorities: %v", err)
+	}
+	checkHeap(t, q)
+
+	if err := q.SwapPriorities(1, 100); err != ErrElementNotFound {
+		t.Fatalf("absent b: err=%v, want=%v", err, ErrElementNotFound)
+	}
+	if err := q.SwapPriorities(100, 1); err != ErrElementNotFound {
+		t.Fatalf("absent a: err=%v, want=%v", err, ErrElementNotFound)
+	}
+	if p, _ := q.PriorityOf(1); p != 1 {
+		t.Fatalf("failed swap mutated priority: %v", p)
+	}
+}
+
+func TestPeekTopKLeavesQueueIntact(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(4))
+	q := NewPriorityQueue[int](3, 0)
+	for i := 0; i < 100; i++ {
+		_ = q.Insert(i, float32(rng.Intn(50)))
+	}
+	before := append([]Pair[int](nil), q.pairs...)
+
+	top := q.PeekTopK(5)
+	if len(top) != 5 {
+		t.Fatalf("len=%d, want=5", len(top))
+	}
+	for i := 1; i < len(top); i++ {
+		if top[i].priority > top[i-1].priority {
+			t.Fatalf("not descending: %v", top)
+		}
+	}
+	for i := range before {
+		if before[i] != q.pairs[i] {
+			t.Fatalf("queue mutated at %d", i)
+		}
+	}
+	checkHeap(t, q)
+
+	for i := 0; i < 5; i++ {
+		p, _ := q.Top()
+		if p.priority != top[i].priority {
+			t.Fatalf("PeekTopK[%d]=%v, Top=%v", i, top[i].priority, p.priority)
+		}
+	}
+
+	if got := q.PeekTopK(1000); len(got) != 95 {
+		t.Fatalf("k > len: got %d, want 95", len(got))
+	}
+	if got := q.PeekTopK(0); got == nil || len(got) != 0 {
+		t.Fatalf("k=0: got %v, want empty slice", got)
+	}
+	if got := q.PeekTopK(-3); len(got) != 0 {
+		t.Fatalf("k<0: got %v, want empty slice", got)
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	t.Parallel()
+
+	q := NewMinPriorityQueue[int](4, 0)
+	for i := 0; i < 40; i++ {
+		_ = q.Insert(i, float32((i*7)%40))
+	}
+
+	c := q.Clone()
+	checkHeap(t, c)
+	if c.sizeD != q.sizeD || c.minOrder != q.minOrder {
+		t.Fatalf("clone lost configuration")
+	}
+
+	_ = c.Insert(100, -1)
+	_ = c.Update(5, 1000)
+	for {
+		if _, err := c.Top(); err != nil {
+			break
+		}
+	}
+
+	checkHeap(t, q)
+	if len(q.pairs) != 40 || q.Contains(100) {
+		t.Fatalf("original changed: len=%d", len(q.pairs))
+	}
+	if p, _ := q.PriorityOf(5); p != 35 {
+		t.Fatalf("original priority changed: %v", p)
+	}
+	for i := 0; i < 40; i++ {
+		if _, err := q.Top(); err != nil {
+			t.Fatalf("Top %d: %v", i, err)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(5))
+	q := NewPriorityQueue[string](3, 0)
+	want := make(map[string]float32)
+	for i := 0; i < 40; i++ {
+		v := fmt.Sprintf("item-%02d", i)
+		p := float32(rng.Intn(100)) / 4
+		_ = q.Insert(v, p)
+		want[v] = p
+	}
+
+	data, err := json.Marshal(q)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var got PriorityQueue[string]
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	checkHeap(t, &got)
+	if got.sizeD != 3 || got.minOrder {
+		t.Fatalf("configuration lost: d=%d min=%v", got.sizeD, got.minOrder)
+	}
+	if len(got.pairs) != len(want) {
+		t.Fatalf("len=%d, want=%d", len(got.pairs), len(want))
+	}
+	for v, p := range want {
+		gp, err := got.PriorityOf(v)
+		if err != nil || gp != p {
+			t.Fatalf("PriorityOf(%q)=%v,%v want %v", v, gp, err, p)
+		}
+	}
+}
+
+func TestJSONRoundTripKeepsFIFOOrder(t *testing.T) {
+	t.Parallel()
+
+	q := NewStablePriorityQueue[string](2, 0)
+	for _, v := range []string{"a", "b", "c", "d", "e"} {
+		_ = q.Insert(v, 1)
+	}
+	_ = q.Insert("f", 2)
+	_ = q.Update("c", 3)
+	_ = q.Update("c", 1)
+
+	data, err := json.Marshal(q)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got PriorityQueue[string]
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !got.stable {
+		t.Fatalf("stable mode lost in round trip")
+	}
+
+	for _, want := range []string{"f", "a", "b", "c", "d", "e"} {
+		if p, err := got.Top(); err != nil || p.Value() != want {
+			t.Fatalf("Top=%v,%v want %v", p.Value(), err, want)
+		}
+	}
+}
+
+func TestUnmarshalJSONRejectsDuplicates(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`{"d":2,"pairs":[{"value":"a","priority":1},{"value":"a","priority":2}]}`)
+	var q PriorityQueue[string]
+	if err := json.Unmarshal(data, &q); err != ErrElementExists {
+		t.Fatalf("err=%v, want=%v", err, ErrElementExists)
+	}
+}
+
+func TestSortPairsDescMatchesSortSlice(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(6))
+	for _, d := range []int{0, 2, 3, 5} {
+		for _, n := range []int{0, 1, 2, 17, 300} {
+			pairs := make([]Pair[int], n)
+			for i := range pairs {
+				pairs[i] = NewPair(i, float32(rng.Intn(50)))
+			}
+			want := append([]Pair[int](nil), pairs...)
+			sort.Slice(want, func(i, j int) bool { return want[i].priority > want[j].priority })
+
+			SortPairsDesc(pairs, d)
+			for i := range pairs {
+				if pairs[i].priority != want[i].priority {
+					t.Fatalf("d=%d n=%d: index %d priority=%v, want=%v", d, n, i, pairs[i].priority, want[i].priority)
+				}
+			}
+		}
+	}
+}
+
+func TestClearReusesBackingSlice(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[int](2, 16)
+	for i := 0; i < 16; i++ {
+		_ = q.Insert(i, float32(i))
+	}
+	capBefore := cap(q.pairs)
+
+	q.Clear()
+	if q.Len() != 0 {
+		t.Fatalf("Len=%d after Clear, want 0", q.Len())
+	}
+	if cap(q.pairs) != capBefore {
+		t.Fatalf("cap=%d after Clear, want %d", cap(q.pairs), capBefore)
+	}
+	if len(q.indexMap) != 0 || q.Contains(3) {
+		t.Fatalf("stale entries in indexMap: %v", q.indexMap)
+	}
+	if _, err := q.Top(); err != ErrQueueIsEmpty {
+		t.Fatalf("Top after Clear: err=%v, want=%v", err, ErrQueueIsEmpty)
+	}
+
+	for i := 100; i < 108; i++ {
+		if err := q.Insert(i, float32(i)); err != nil {
+			t.Fatalf("Insert after Clear: %v", err)
+		}
+	}
+	if err := q.Insert(3, 1); err != nil {
+		t.Fatalf("re-inserting cleared value: %v", err)
+	}
+	checkHeap(t, q)
+	if q.Len() != 9 {
+		t.Fatalf("Len=%d, want 9", q.Len())
+	}
+}
+
+func TestEachVisitsInPriorityOrder(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[string](3, 0)
+	for i, v := range []string{"e", "b", "d", "a", "c"} {
+		_ = q.Insert(v, float32(i*10))
+	}
+	before := append([]Pair[string](nil), q.pairs...)
+
+	var visited []string
+	q.Each(func(value string, priority float32) bool {
+		visited = append(visited, value)
+		return true
+	})
+	want := []string{"c", "a", "d", "b", "e"}
+	if fmt.Sprint(visited) != fmt.Sprint(want) {
+		t.Fatalf("visit order=%v, want=%v", visited, want)
+	}
+	for i := range before {
+		if before[i] != q.pairs[i] {
+			t.Fatalf("queue mutated at %d", i)
+		}
+	}
+
+	visited = visited[:0]
+	q.Each(func(value string, priority float32) bool {
+		visited = append(visited, value)
+		return len(visited) < 2
+	})
+	if len(visited) != 2 {
+		t.Fatalf("early stop visited %d, want 2", len(visited))
+	}
+
+	NewPriorityQueue[int](2, 0).Each(func(int, float32) bool {
+		t.Fatalf("Each on empty queue called fn")
+		return false
+	})
+}
+
+func TestDrainToSendsInPriorityOrder(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(7))
+	q := NewPriorityQueue[int](4, 0)
+	for i := 0; i < 64; i++ {
+		_ = q.Insert(i, float32(rng.Intn(20)))
+	}
+
+	ch := make(chan Pair[int], q.Len())
+	q.DrainTo(ch)
+	if q.Len() != 0 || len(q.indexMap) != 0 {
+		t.Fatalf("queue not empty after DrainTo: len=%d", q.Len())
+	}
+	if len(ch) != 64 {
+		t.Fatalf("received %d pairs, want 64", len(ch))
+	}
+
+	close(ch)
+	prev := float32(math.MaxFloat32)
+	for p := range ch {
+		if p.priority > prev {
+			t.Fatalf("priority increased: %v after %v", p.priority, prev)
+		}
+		prev = p.priority
+	}
+}
+
+func TestSelectTopKMatchesFullSort(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(8))
+	all := make([]Pair[int], 100_000)
+	for i := range all {
+		all[i] = NewPair(i, rng.Float32())
+	}
+
+	ch := make(chan Pair[int], 128)
+	go func() {
+		for _, p := range all {
+			ch <- p
+		}
+		close(ch)
+	}()
+	got := SelectTopK(25, ch)
+
+	sort.Slice(all, func(i, j int) bool { return all[i].priority > all[j].priority })
+	if len(got) != 25 {
+		t.Fatalf("len=%d, want=25", len(got))
+	}
+	for i := range got {
+		if got[i].priority != all[i].priority {
+			t.Fatalf("index %d priority=%v, want=%v", i, got[i].priority, all[i].priority)
+		}
+	}
+}
+
+func TestSelectTopKShortStreamAndZeroK(t *testing.T) {
+	t.Parallel()
+
+	ch := make(chan Pair[string], 3)
+	ch <- NewPair("a", 1)
+	ch <- NewPair("b", 3)
+	ch <- NewPair("c", 2)
+	close(ch)
+	got := SelectTopK(10, ch)
+	if len(got) != 3 || got[0].Value() != "b" || got[2].Value() != "a" {
+		t.Fatalf("got %v", got)
+	}
+
+	ch = make(chan Pair[string], 1)
+	ch <- NewPair("a", 1)
+	close(ch)
+	if got := SelectTopK(0, ch); len(got) != 0 {
+		t.Fatalf("k=0: got %v", got)
+	}
+}
+
+func TestRebuildChangesArity(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(9))
+	q := NewPriorityQueue[int](2, 0)
+	for i := 0; i < 257; i++ {
+		_ = q.Insert(i, float32(rng.Intn(1000)))
+	}
+
+	for _, d := range []int{4, 3, 8, 1, 2, 16} {
+		q.Rebuild(d)
+		want := d
+		if want < 2 {
+			want = 2
+		}
+		if q.sizeD != want {
+			t.Fatalf("sizeD=%d, want=%d", q.sizeD, want)
+		}
+		checkHeap(t, q)
+		if q.Len() != 257 {
+			t.Fatalf("Len=%d after Rebuild(%d)", q.Len(), d)
+		}
+	}
+
+	prev := float32(math.MaxFloat32)
+	for q.Len() > 0 {
+		p, _ := q.Top()
+		if p.priority > prev {
+			t.Fatalf("order violated after rebuilds: %v after %v", p.priority, prev)
+		}
+		prev = p.priority
+	}
+}
+
+func TestValidateHeapDetectsCorruption(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[int](3, 0)
+	for i := 0; i < 20; i++ {
+		_ = q.Insert(i, float32(i))
+	}
+	if err := q.ValidateHeap(); err != nil {
+		t.Fatalf("valid heap reported: %v", err)
+	}
+
+	c := q.Clone()
+	c.pairs[c.Len()-1].priority = 1000
+	if err := c.ValidateHeap(); err == nil {
+		t.Fatalf("priority corruption not detected")
+	}
+
+	c = q.Clone()
+	c.indexMap[c.pairs[3].value] = 4
+	if err := c.ValidateHeap(); err == nil {
+		t.Fatalf("indexMap corruption not detected")
+	}
+
+	c = q.Clone()
+	delete(c.indexMap, c.pairs[0].value)
+	if err := c.ValidateHeap(); err == nil {
+		t.Fatalf("missing indexMap entry not detected")
+	}
+
+	if err := q.ValidateHeap(); err != nil {
+		t.Fatalf("original affected by corrupting clones: %v", err)
+	}
+}
+
+func TestBoundedInsertEvictingEvictsLowest(t *testing.T) {
+	t.Parallel()
+
+	const capacity = 10
+	rng := rand.New(rand.NewSource(10))
+	b := NewBoundedPriorityQueue[int](2, capacity)
+
+	priorities := make([]float32, 200)
+	for i := range priorities {
+		priorities[i] = float32(rng.Intn(1_000_000))
+	}
+
+	retained := make(map[int]float32)
+	for i, p := range priorities {
+		var lowest Pair[int]
+		if b.Len() == capacity {
+			lowest, _ = b.Peek()
+		}
+
+		evicted, didEvict := b.InsertEvicting(i, p)
+		if i < capacity {
+			if didEvict {
+				t.Fatalf("evicted below capacity at %d", i)
+			}
+			retained[i] = p
+			continue
+		}
+
+		if didEvict {
+			if evicted != lowest {
+				t.Fatalf("evicted %v, want lowest %v", evicted, lowest)
+			}
+			for _, rp := range retained {
+				if rp < evicted.priority {
+					t.Fatalf("evicted %v while %v retained", evicted.priority, rp)
+				}
+			}
+			delete(retained, evicted.value)
+			retained[i] = p
+		} else if b.Contains(i) {
+			t.Fatalf("rejected element %d is present", i)
+		}
+		if b.Len() != capacity {
+			t.Fatalf("Len=%d, want=%d", b.Len(), capacity)
+		}
+	}
+
+	sort.Slice(priorities, func(i, j int) bool { return priorities[i] > priorities[j] })
+	for v, p := range retained {
+		if !b.Contains(v) {
+			t.Fatalf("retained %d missing", v)
+		}
+		if p < priorities[capacity-1] {
+			t.Fatalf("retained priority %v below top-%d threshold %v", p, capacity, priorities[capacity-1])
+		}
+	}
+}
+
+func TestConcurrentPriorityQueue(t *testing.T) {
+	t.Parallel()
+
+	const workers, perWorker = 8, 200
+	q := NewConcurrentPriorityQueue[int](4, 0)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if err := q.Insert(w*perWorker+i, float32(i)); err != nil {
+					t.Errorf("Insert: %v", err)
+				}
+				_, _ = q.Peek()
+				_ = q.Len()
+			}
+		}(w)
+	}
+	wg.Wait()
+	if q.Len() != workers*perWorker {
+		t.Fatalf("Len=%d, want=%d", q.Len(), workers*perWorker)
+	}
+
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				p, err := q.Top()
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				seen[p.value] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != workers*perWorker {
+		t.Fatalf("popped %d distinct elements, want %d", len(seen), workers*perWorker)
+	}
+	checkHeap(t, q.queue)
+}
+
+func TestGenericPriorityTypes(t *testing.T) {
+	t.Parallel()
+
+	qi := NewPriorityQueueOf[string, int64](2, 0)
+	_ = qi.Insert("a", 1<<40)
+	_ = qi.Insert("b", 1<<40+1)
+	_ = qi.Insert("c", -5)
+	if err := qi.ValidateHeap(); err != nil {
+		t.Fatal(err)
+	}
+	top, _ := qi.Top()
+	if top.Value() != "b" || top.Priority() != 1<<40+1 {
+		t.Fatalf("int Top=%v/%v, want b/%d", top.Value(), top.Priority(), int64(1<<40+1))
+	}
+
+	qf := NewMinPriorityQueueOf[int, float64](3, 0)
+	for i := 0; i < 50; i++ {
+		_ = qf.Insert(i, 1e-12*float64(50-i))
+	}
+	if err := qf.ValidateHeap(); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := qf.Peek(); p.Value() != 49 {
+		t.Fatalf("float64 min Peek=%v, want 49", p.Value())
+	}
+	_ = qf.Update(0, 0)
+	if p, _ := qf.Peek(); p.Value() != 0 {
+		t.Fatalf("float64 Peek after Update=%v, want 0", p.Value())
+	}
+
+	sorted := []PairOf[string, int]{NewPairOf("x", 3), NewPairOf("y", 9), NewPairOf("z", 1)}
+	SortPairsDesc(sorted, 2)
+	if sorted[0].Value() != "y" || sorted[2].Value() != "z" {
+		t.Fatalf("SortPairsDesc with int priorities: %v", sorted)
+	}
+}
+
+func TestMergeCombinesQueues(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(11))
+	a := NewPriorityQueue[int](3, 0)
+	b := NewPriorityQueue[int](2, 0)
+	for i := 0; i < 60; i++ {
+		_ = a.Insert(i, float32(rng.Intn(100)))
+		_ = b.Insert(i+1000, float32(rng.Intn(100)))
+	}
+
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	checkHeap(t, a)
+	checkHeap(t, b)
+	if a.Len() != 120 || b.Len() != 60 {
+		t.Fatalf("Len a=%d b=%d, want 120 and 60", a.Len(), b.Len())
+	}
+	for i := 0; i < 60; i++ {
+		if !a.Contains(i) || !a.Contains(i+1000) {
+			t.Fatalf("merged queue misses %d or %d", i, i+1000)
+		}
+	}
+
+	if err := a.Merge(NewPriorityQueue[int](2, 0)); err != nil {
+		t.Fatalf("Merge empty: %v", err)
+	}
+	empty := NewPriorityQueue[int](2, 0)
+	if err := empty.Merge(b); err != nil || empty.Len() != 60 {
+		t.Fatalf("Merge into empty: err=%v len=%d", err, empty.Len())
+	}
+	checkHeap(t, empty)
+}
+
+func TestMergeRejectsCollisions(t *testing.T) {
+	t.Parallel()
+
+	a := NewPriorityQueue[string](2, 0)
+	b := NewPriorityQueue[string](2, 0)
+	_ = a.Insert("x", 1)
+	_ = b.Insert("y", 2)
+	_ = b.Insert("x", 3)
+
+	if err := a.Merge(b); err != ErrElementExists {
+		t.Fatalf("err=%v, want=%v", err, ErrElementExists)
+	}
+	if a.Len() != 1 || a.Contains("y") {
+		t.Fatalf("failed Merge modified the queue")
+	}
+	checkHeap(t, a)
+}
+
+func TestToSortedSlice(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(12))
+	q := NewPriorityQueue[int](3, 0)
+	for i := 0; i < 77; i++ {
+		_ = q.Insert(i, float32(rng.Intn(30)))
+	}
+
+	got := q.ToSortedSlice()
+	if len(got) != 77 {
+		t.Fatalf("len=%d, want=77", len(got))
+	}
+	if !sort.SliceIsSorted(got, func(i, j int) bool { return got[i].priority > got[j].priority }) {
+		t.Fatalf("not sorted descending")
+	}
+	checkHeap(t, q)
+	if q.Len() != 77 {
+		t.Fatalf("queue modified: Len=%d", q.Len())
+	}
+
+	mq := NewMinPriorityQueue[int](2, 0)
+	for i := 0; i < 20; i++ {
+		_ = mq.Insert(i, float32(rng.Intn(30)))
+	}
+	mgot := mq.ToSortedSlice()
+	if !sort.SliceIsSorted(mgot, func(i, j int) bool { return mgot[i].priority < mgot[j].priority }) {
+		t.Fatalf("min queue slice not ascending")
+	}
+
+	if got := NewPriorityQueue[int](2, 0).ToSortedSlice(); len(got) != 0 {
+		t.Fatalf("empty queue: %v", got)
+	}
+}
+
+func TestDecayPreservesOrder(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[int](3, 0)
+	for i := 0; i < 30; i++ {
+		_ = q.Insert(i, float32(i+1))
+	}
+	want := q.ToSortedSlice()
+	backing := &q.pairs[0]
+
+	q.Decay(0.5)
+	if &q.pairs[0] != backing {
+		t.Fatalf("Decay reallocated the backing slice")
+	}
+	checkHeap(t, q)
+	if p, _ := q.PriorityOf(9); p != 5 {
+		t.Fatalf("PriorityOf(9)=%v, want 5", p)
+	}
+	for _, w := range want {
+		got, _ := q.Top()
+		if got.value != w.value {
+			t.Fatalf("Top=%v, want %v", got.value, w.value)
+		}
+	}
+}
+
+func TestDecayNegativeFactorReheapifies(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[int](2, 0)
+	for i := 0; i < 10; i++ {
+		_ = q.Insert(i, float32(i))
+	}
+	q.Decay(-1)
+	checkHeap(t, q)
+	if top, _ := q.Peek(); top.value != 0 {
+		t.Fatalf("Peek=%v after negative decay, want 0", top.value)
+	}
+}
+
+func TestDecayIgnoresNaN(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[int](2, 0)
+	for i := 0; i < 10; i++ {
+		_ = q.Insert(i, float32(i))
+	}
+	q.Decay(float32(math.NaN()))
+	checkHeap(t, q)
+	if p, _ := q.PriorityOf(9); p != 9 {
+		t.Fatalf("PriorityOf(9)=%v after NaN decay, want 9", p)
+	}
+}
+
+func TestDecayTruncatesIntegerPriorities(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueueOf[string, int](2, 0)
+	q.stable = true
+	_ = q.Insert("a", 4)
+	_ = q.Insert("b", 5)
+	q.Decay(0.5)
+	if p, _ := q.PriorityOf("b"); p != 2 {
+		t.Fatalf("PriorityOf(b)=%v, want 2 after truncation", p)
+	}
+	if err := q.ValidateHeap(); err != nil {
+		t.Fatalf("heap invalid after truncating decay: %v", err)
+	}
+	if top, _ := q.Top(); top.value != "a" {
+		t.Fatalf("Top=%v, want the earlier of the new ties", top.value)
+	}
+}
+
+func TestSubtreeSlice(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[int](2, 0)
+	for i := 15; i > 0; i-- {
+		_ = q.Insert(i, float32(i))
+	}
+	// Inserting in descending order keeps each pair at index 15-value.
+	values := func(pairs []Pair[int]) []int {
+		out := make([]int, len(pairs))
+		for i, p := range pairs {
+			out[i] = p.value
+		}
+		return out
+	}
+
+	cases := map[int][]int{
+		0:  {15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1},
+		1:  {14, 12, 11, 8, 7, 6, 5},
+		2:  {13, 10, 9, 4, 3, 2, 1},
+		5:  {10, 4, 3},
+		14: {1},
+		15: {},
+		-1: {},
+	}
+	for index, want := range cases {
+		if got := values(q.SubtreeSlice(index)); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("SubtreeSlice(%d)=%v, want=%v", index, got, want)
+		}
+	}
+
+	q3 := NewPriorityQueue[int](3, 0)
+	for i := 10; i > 0; i-- {
+		_ = q3.Insert(i, float32(i))
+	}
+	if got := values(q3.SubtreeSlice(1)); fmt.Sprint(got) != "[9 6 5 4]" {
+		t.Fatalf("d=3 SubtreeSlice(1)=%v", got)
+	}
+}
+
+func TestWriteAsciiTreeMatchesString(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[string](3, 0)
+	var buf bytes.Buffer
+	if err := q.WriteAsciiTree(&buf); err != nil || buf.String() != "(empty)\n" {
+		t.Fatalf("empty tree: %q, %v", buf.String(), err)
+	}
+
+	for i := 0; i < 25; i++ {
+		_ = q.Insert(fmt.Sprintf("n%d", i), float32(i%9))
+	}
+	buf.Reset()
+	if err := q.WriteAsciiTree(&buf); err != nil {
+		t.Fatalf("WriteAsciiTree: %v", err)
+	}
+	if buf.String() != q.AsciiTree() {
+		t.Fatalf("WriteAsciiTree output differs:\n%s\nvs\n%s", buf.String(), q.AsciiTree())
+	}
+}
+
+type failingWriter struct{ left int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.left == 0 {
+		return 0, errors.New("write failed")
+	}
+	w.left--
+	return len(p), nil
+}
+
+func TestWriteAsciiTreeReturnsWriteError(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[int](2, 0)
+	for i := 0; i < 10; i++ {
+		_ = q.Insert(i, float32(i))
+	}
+	if err := q.WriteAsciiTree(&failingWriter{left: 4}); err == nil {
+		t.Fatalf("expected write error")
+	}
+}
+
+func TestDepth(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct{ n, d, want int }{
+		{0, 2, 0},
+		{1, 2, 1},
+		{2, 2, 2},
+		{3, 2, 2},
+		{4, 2, 3},
+		{7, 2, 3},
+		{8, 2, 4},
+		{1, 4, 1},
+		{5, 4, 2},
+		{6, 4, 3},
+		{21, 4, 3},
+		{22, 4, 4},
+		{13, 3, 3},
+		{14, 3, 4},
+	}
+	for _, c := range cases {
+		q := NewPriorityQueue[int](c.d, c.n)
+		for i := 0; i < c.n; i++ {
+			_ = q.Insert(i, float32(i))
+		}
+		if got := q.Depth(); got != c.want {
+			t.Fatalf("n=%d d=%d: Depth=%d, want=%d", c.n, c.d, got, c.want)
+		}
+	}
+
+	pairs := make([]Pair[int], 5000)
+	for d := 2; d <= 7; d++ {
+		q := NewPriorityQueue[int](d, 0)
+		want, full, width := 0, 0, 1
+		for n := 0; n <= 5000; n++ {
+			for full < n {
+				full += width
+				width *= d
+				want++
+			}
+			q.pairs = pairs[:n]
+			if got := q.Depth(); got != want {
+				t.Fatalf("n=%d d=%d: Depth=%d, want=%d", n, d, got, want)
+			}
+		}
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[string](2, 0)
+	for i := 0; i < 10; i++ {
+		_ = q.Insert(fmt.Sprintf("v%d", i), float32(i))
+	}
+
+	if !q.Discard("v4") {
+		t.Fatalf("Discard of present element returned false")
+	}
+	if q.Discard("v4") {
+		t.Fatalf("second Discard returned true")
+	}
+	if q.Discard("missing") {
+		t.Fatalf("Discard of absent element returned true")
+	}
+	checkHeap(t, q)
+	if q.Len() != 9 || q.Contains("v4") {
+		t.Fatalf("Len=%d Contains(v4)=%v", q.Len(), q.Contains("v4"))
+	}
+	if NewPriorityQueue[int](2, 0).Discard(1) {
+		t.Fatalf("Discard on empty queue returned true")
+	}
+}
+
+func TestTieBreakOrdersEqualPriorities(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueueTieBreak[string](3, 0, func(a, b string) bool { return a < b })
+	for _, v := range []string{"delta", "alpha", "echo", "charlie", "bravo"} {
+		_ = q.Insert(v, 1)
+	}
+	_ = q.Insert("top", 5)
+	_ = q.Insert("bottom", 0)
+	checkHeap(t, q)
+
+	want := []string{"top", "alpha", "bravo", "charlie", "delta", "echo", "bottom"}
+	if got := q.ToSortedSlice(); len(got) != len(want) || got[1].Value() != "alpha" {
+		t.Fatalf("ToSortedSlice ignores tie-break: %v", got)
+	}
+
+	_ = q.Remove("charlie")
+	_ = q.Insert("charlie", 1)
+	checkHeap(t, q)
+
+	for _, w := range want {
+		top, err := q.Top()
+		if err != nil {
+			t.Fatalf("Top: %v", err)
+		}
+		if top.Value() != w {
+			t.Fatalf("Top = %q, want %q", top.Value(), w)
+		}
+	}
+}
+
+func TestHeapInterfaceAdapter(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[string](4, 0)
+	_ = q.Insert("seed", 5)
+	h := q.HeapInterface()
+	checkHeap(t, q)
+
+	rng := rand.New(rand.NewSource(61))
+	for i := 0; i < 100; i++ {
+		heap.Push(h, NewPair(fmt.Sprintf("v%d", i), float32(rng.Intn(50))))
+	}
+	checkHeap(t, q)
+	if q.Len() != 101 {
+		t.Fatalf("Len=%d, want 101", q.Len())
+	}
+
+	q.pairs[q.indexMap["v7"]].priority = 1000
+	heap.Fix(h, q.indexMap["v7"])
+	if top, _ := q.Peek(); top.Value() != "v7" {
+		t.Fatalf("Peek after heap.Fix = %v, want v7", top.Value())
+	}
+
+	prev := float32(math.Inf(1))
+	for h.Len() > 0 {
+		p := heap.Pop(h).(Pair[string])
+		if p.Priority() > prev {
+			t.Fatalf("heap.Pop out of order: %v after %v", p.Priority(), prev)
+		}
+		if q.Contains(p.Value()) {
+			t.Fatalf("popped %q still in indexMap", p.Value())
+		}
+		prev = p.Priority()
+	}
+	checkHeap(t, q)
+
+	defer func() {
+		if r := recover(); r != ErrElementExists {
+			t.Fatalf("duplicate heap.Push recovered %v, want ErrElementExists", r)
+		}
+	}()
+	heap.Push(h, NewPair("dup", 1))
+	heap.Push(h, NewPair("dup", 2))
+}
+
+func TestStableModeIsFIFO(t *testing.T) {
+	t.Parallel()
+
+	q := NewStablePriorityQueue[int](3, 0)
+	for i := 0; i < 50; i++ {
+		_ = q.Insert(i, float32(i%3))
+	}
+	checkHeap(t, q)
+	_ = q.Update(4, 2)
+
+	// 4 moves to priority 2 but keeps its insertion position, between 2 and 5.
+	priority := func(i int) int {
+		if i == 4 {
+			return 2
+		}
+		return i % 3
+	}
+	want := make([]int, 0, 50)
+	for p := 2; p >= 0; p-- {
+		for i := 0; i < 50; i++ {
+			if priority(i) == p {
+				want = append(want, i)
+			}
+		}
+	}
+
+	if sorted := q.ToSortedSlice(); sorted[0].Value() != want[0] || sorted[len(sorted)-1].Value() != want[len(want)-1] {
+		t.Fatalf("ToSortedSlice ignores insertion order")
+	}
+	for _, w := range want {
+		top, err := q.Top()
+		if err != nil {
+			t.Fatalf("Top: %v", err)
+		}
+		if top.Value() != w {
+			t.Fatalf("Top = %d, want %d", top.Value(), w)
+		}
+	}
+}
+
+func TestPopBatch(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[int](3, 0)
+	rng := rand.New(rand.NewSource(67))
+	for _, i := range rng.Perm(30) {
+		_ = q.Insert(i, float32(i))
+	}
+
+	batch := q.PopBatch(10)
+	if len(batch) != 10 {
+		t.Fatalf("PopBatch(10) returned %d pairs", len(batch))
+	}
+	for i, p := range batch {
+		if p.Value() != 29-i {
+			t.Fatalf("batch[%d] = %d, want %d", i, p.Value(), 29-i)
+		}
+	}
+
+	checkHeap(t, q)
+	if q.Len() != 20 {
+		t.Fatalf("Len=%d after batch, want 20", q.Len())
+	}
+	for i := 0; i < 30; i++ {
+		if q.Contains(i) != (i < 20) {
+			t.Fatalf("Contains(%d)=%v after batch", i, q.Contains(i))
+		}
+	}
+
+	if rest := q.PopBatch(100); len(rest) != 20 || q.Len() != 0 {
+		t.Fatalf("oversized PopBatch returned %d, left %d", len(rest), q.Len())
+	}
+	if empty := q.PopBatch(5); len(empty) != 0 {
+		t.Fatalf("PopBatch on empty queue returned %v", empty)
+	}
+	if neg := NewPriorityQueue[int](2, 0).PopBatch(-1); len(neg) != 0 {
+		t.Fatalf("PopBatch(-1) returned %v", neg)
+	}
+}
+
+func TestAdjust(t *testing.T) {
+	t.Parallel()
+
+	q := NewPriorityQueue[string](2, 0)
+	for i, v := range []string{"a", "b", "c", "d", "e", "f"} {
+		_ = q.Insert(v, float32(i*10))
+	}
+
+	if err := q.Adjust("a", 100); err != nil {
+		t.Fatalf("Adjust up: %v", err)
+	}
+	checkHeap(t, q)
+	if top, _ := q.Peek(); top.Value() != "a" || top.Priority() != 100 {
+		t.Fatalf("Peek = %v(%v), want a(100)", top.Value(), top.Priority())
+	}
+
+	if err := q.Adjust("a", -200); err != nil {
+		t.Fatalf("Adjust down: %v", err)
+	}
+	checkHeap(t, q)
+	if p, _ := q.PriorityOf("a"); p != -100 {
+		t.Fatalf("PriorityOf(a) = %v, want -100", p)
+	}
+	if top, _ := q.Peek(); top.Value() != "f" {
+		t.Fatalf("Peek = %v, want f once a sinks", top.Value())
+	}
+	sorted := q.ToSortedSlice()
+	if last := sorted[len(sorted)-1]; last.Value() != "a" {
+		t.Fatalf("lowest element = %v, want a", last.Value())
+	}
+
+	if err := q.Adjust("missing", 1); err != ErrElementNotFound {
+		t.Fatalf("Adjust of absent element: err=%v, want ErrElementNotFound", err)
+	}
+}
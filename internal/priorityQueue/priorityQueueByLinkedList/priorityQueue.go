@@ -3,37 +3,149 @@ package priorityQueueByLinkedList
 import (
 	"errors"
 	"fmt"
-	"golang.org/x/exp/constraints"
 	"strings"
 )
 
 var (
 	ErrEmpty    = errors.New("priorityQueue: is empty")
 	ErrNotFound = errors.New("priorityQueue: node not found")
+	ErrExists   = errors.New("priorityQueue: element already exists")
 )
 
-type PriorityQueue[T constraints.Ordered] struct {
-	root  *Node[T]
-	sizeD int
-	size  int
+type PriorityQueue[T comparable] struct {
+	root     *Node[T]
+	sizeD    int
+	size     int
+	nodes    map[T]*Node[T]
+	minOrder bool
 }
 
-type Node[T constraints.Ordered] struct {
+type Node[T comparable] struct {
 	childes []*Node[T]
 	parent  *Node[T]
 	pair    Pair[T]
 }
 
-type Pair[T constraints.Ordered] struct {
+type Pair[T comparable] struct {
 	priority float64
 	value    T
 }
 
-func NewPriorityQueue[T constraints.Ordered](d int) *PriorityQueue[T] {
+func NewPriorityQueue[T comparable](d int) *PriorityQueue[T] {
 	if d < 2 {
 		d = 2
 	}
-	return &PriorityQueue[T]{sizeD: d}
+	return &PriorityQueue[T]{sizeD: d, nodes: make(map[T]*Node[T])}
+}
+
+// NewMinPriorityQueue returns a queue whose Top yields the lowest priority first.
+func NewMinPriorityQueue[T comparable](d int) *PriorityQueue[T] {
+	p := NewPriorityQueue[T](d)
+	p.minOrder = true
+	return p
+}
+
+// NewFromSlice links pairs level by level in array-index order and heapifies
+// once. If a value occurs more than once, the last pair wins.
+func NewFromSlice[T comparable](d int, pairs []Pair[T]) *PriorityQueue[T] {
+	p := NewPriorityQueue[T](d)
+	p.build(pairs)
+	return p
+}
+
+// Merge moves a copy of other's pairs into p, relinking everything with p's
+// arity and heapifying in O(N+M). Values present in both queues are rejected
+// with ErrExists and leave p unchanged. other is not modified.
+func (p *PriorityQueue[T]) Merge(other *PriorityQueue[T]) error {
+	for value := range other.nodes {
+		if _, ok := p.nodes[value]; ok {
+			return ErrExists
+		}
+	}
+
+	pairs := make([]Pair[T], 0, p.size+other.size)
+	for _, q := range []*PriorityQueue[T]{p, other} {
+		q.Each(func(value T, priority float64) bool {
+			pairs = append(pairs, Pair[T]{priority: priority, value: value})
+			return true
+		})
+	}
+	p.build(pairs)
+	return nil
+}
+
+func (p *PriorityQueue[T]) build(pairs []Pair[T]) {
+	p.root = nil
+	p.nodes = make(map[T]*Node[T], len(pairs))
+	nodes := make([]*Node[T], 0, len(pairs))
+	for _, pair := range pairs {
+		if n, ok := p.nodes[pair.value]; ok {
+			n.pair = pair
+			continue
+		}
+		n := &Node[T]{childes: make([]*Node[T], p.sizeD), pair: pair}
+		if i := len(nodes); i > 0 {
+			n.parent = nodes[(i-1)/p.sizeD]
+			n.parent.childes[(i-1)%p.sizeD] = n
+		}
+		nodes = append(nodes, n)
+		p.nodes[pair.value] = n
+	}
+
+	if len(nodes) > 0 {
+		p.root = nodes[0]
+	}
+	p.size = len(nodes)
+	p.heapify()
+}
+
+func NewPair[T comparable](value T, priority float64) Pair[T] {
+	return Pair[T]{priority: priority, value: value}
+}
+
+func (p Pair[T]) Value() T {
+	return p.value
+}
+
+func (p Pair[T]) Priority() float64 {
+	return p.priority
+}
+
+func (p *PriorityQueue[T]) Len() int {
+	return p.size
+}
+
+func (p *PriorityQueue[T]) IsEmpty() bool {
+	return p.size == 0
+}
+
+func (p *PriorityQueue[T]) Clear() {
+	p.root = nil
+	p.size = 0
+	clear(p.nodes)
+}
+
+func (p *PriorityQueue[T]) Clone() *PriorityQueue[T] {
+	c := &PriorityQueue[T]{
+		sizeD:    p.sizeD,
+		size:     p.size,
+		nodes:    make(map[T]*Node[T], p.size),
+		minOrder: p.minOrder,
+	}
+	c.root = c.cloneNode(p.root, nil)
+	return c
+}
+
+func (p *PriorityQueue[T]) cloneNode(n *Node[T], parent *Node[T]) *Node[T] {
+	if n == nil {
+		return nil
+	}
+	c := &Node[T]{childes: make([]*Node[T], len(n.childes)), parent: parent, pair: n.pair}
+	p.nodes[c.pair.value] = c
+	for i, ch := range n.childes {
+		c.childes[i] = p.cloneNode(ch, c)
+	}
+	return c
 }
 
 func (p *PriorityQueue[T]) Top() (Pair[T], error) {
@@ -42,6 +154,7 @@ func (p *PriorityQueue[T]) Top() (Pair[T], error) {
 		return zero, ErrEmpty
 	}
 	maxPair := p.root.pair
+	delete(p.nodes, maxPair.value)
 
 	if p.size == 1 {
 		p.root = nil
@@ -51,6 +164,7 @@ func (p *PriorityQueue[T]) Top() (Pair[T], error) {
 
 	last := p.nodeAt(p.size)
 	p.root.pair = last.pair
+	p.nodes[last.pair.value] = p.root
 	p.detachLast()
 	p.pushDownIndex(1)
 
@@ -65,19 +179,25 @@ func (p *PriorityQueue[T]) Peek() (Pair[T], error) {
 	return p.root.pair, nil
 }
 
-func (p *PriorityQueue[T]) Insert(element T, priority float64) {
+func (p *PriorityQueue[T]) Insert(element T, priority float64) error {
+	if _, ok := p.nodes[element]; ok {
+		return ErrExists
+	}
 	newPair := Pair[T]{priority: priority, value: element}
 
 	p.size++
 	if p.root == nil {
 		p.root = &Node[T]{childes: make([]*Node[T], p.sizeD), pair: newPair}
-		return
+		p.nodes[element] = p.root
+		return nil
 	}
 
 	parent, childIdx := p.insertionParentAndIdx(p.size)
 	node := &Node[T]{childes: make([]*Node[T], p.sizeD), parent: parent, pair: newPair}
 	parent.childes[childIdx] = node
+	p.nodes[element] = node
 	p.bubbleUpNode(node)
+	return nil
 }
 
 func (p *PriorityQueue[T]) Remove(element T) error {
@@ -85,19 +205,11 @@ func (p *PriorityQueue[T]) Remove(element T) error {
 		return ErrEmpty
 	}
 
-	var target *Node[T]
-	var targetIdx int
-	for i := 1; i <= p.size; i++ {
-		n := p.nodeAt(i)
-		if n != nil && n.pair.value == element {
-			target = n
-			targetIdx = i
-			break
-		}
-	}
-	if target == nil {
+	target, ok := p.nodes[element]
+	if !ok {
 		return ErrNotFound
 	}
+	delete(p.nodes, element)
 
 	if p.size == 1 {
 		p.root = nil
@@ -105,17 +217,18 @@ func (p *PriorityQueue[T]) Remove(element T) error {
 		return nil
 	}
 
-	if targetIdx == p.size {
+	last := p.nodeAt(p.size)
+	if last == target {
 		p.detachLast()
 		return nil
 	}
 
-	last := p.nodeAt(p.size)
 	oldPriority := target.pair.priority
 	target.pair = last.pair
+	p.nodes[target.pair.value] = target
 	p.detachLast()
 
-	if target.pair.priority > oldPriority {
+	if p.higher(target.pair.priority, oldPriority) {
 		p.bubbleUpNode(target)
 	} else {
 		p.pushDownNode(target)
@@ -127,27 +240,63 @@ func (p *PriorityQueue[T]) Update(element T, newPriority float64) error {
 	if p.size == 0 {
 		return ErrEmpty
 	}
-	var node *Node[T]
-	for i := 1; i <= p.size; i++ {
-		n := p.nodeAt(i)
-		if n != nil && n.pair.value == element {
-			node = n
-			break
-		}
-	}
-	if node == nil {
+	node, ok := p.nodes[element]
+	if !ok {
 		return ErrNotFound
 	}
 	old := node.pair.priority
 	node.pair.priority = newPriority
-	if newPriority > old {
+	if p.higher(newPriority, old) {
 		p.bubbleUpNode(node)
-	} else if newPriority < old {
+	} else if p.higher(old, newPriority) {
 		p.pushDownNode(node)
 	}
 	return nil
 }
 
+func (p *PriorityQueue[T]) Contains(element T) bool {
+	_, ok := p.nodes[element]
+	return ok
+}
+
+func (p *PriorityQueue[T]) PriorityOf(element T) (float64, error) {
+	node, ok := p.nodes[element]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return node.pair.priority, nil
+}
+
+// Values returns every stored value in heap (breadth-first) order.
+func (p *PriorityQueue[T]) Values() []T {
+	values := make([]T, 0, p.size)
+	p.Each(func(value T, _ float64) bool {
+		values = append(values, value)
+		return true
+	})
+	return values
+}
+
+// Each visits elements breadth-first from the root until fn returns false.
+func (p *PriorityQueue[T]) Each(fn func(value T, priority float64) bool) {
+	if p.root == nil {
+		return
+	}
+	queue := []*Node[T]{p.root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if !fn(n.pair.value, n.pair.priority) {
+			return
+		}
+		for _, ch := range n.childes {
+			if ch != nil {
+				queue = append(queue, ch)
+			}
+		}
+	}
+}
+
 func (p *PriorityQueue[T]) heapify() {
 	if p.size <= 1 {
 		return
@@ -174,8 +323,8 @@ func (p *PriorityQueue[T]) bubbleUpIndex(index int) {
 }
 
 func (p *PriorityQueue[T]) bubbleUpNode(n *Node[T]) {
-	for n.parent != nil && n.pair.priority > n.parent.pair.priority {
-		n.pair, n.parent.pair = n.parent.pair, n.pair
+	for n.parent != nil && p.higher(n.pair.priority, n.parent.pair.priority) {
+		p.swapPairs(n, n.parent)
 		n = n.parent
 	}
 }
@@ -195,25 +344,35 @@ func (q *PriorityQueue[T]) pushDownIndex(currentIndex int) {
 func (q *PriorityQueue[T]) pushDownNode(n *Node[T]) {
 	for {
 		var best *Node[T]
-		bestIdx := -1
-		for i, ch := range n.childes {
+		for _, ch := range n.childes {
 			if ch == nil {
 				continue
 			}
-			if best == nil || ch.pair.priority > best.pair.priority {
+			if best == nil || q.higher(ch.pair.priority, best.pair.priority) {
 				best = ch
-				bestIdx = i
 			}
 		}
-		if best == nil || best.pair.priority <= n.pair.priority {
+		if best == nil || !q.higher(best.pair.priority, n.pair.priority) {
 			return
 		}
-		_ = bestIdx
-		n.pair, best.pair = best.pair, n.pair
+		q.swapPairs(n, best)
 		n = best
 	}
 }
 
+func (p *PriorityQueue[T]) higher(a, b float64) bool {
+	if p.minOrder {
+		return a < b
+	}
+	return a > b
+}
+
+func (p *PriorityQueue[T]) swapPairs(a, b *Node[T]) {
+	a.pair, b.pair = b.pair, a.pair
+	p.nodes[a.pair.value] = a
+	p.nodes[b.pair.value] = b
+}
+
 func (p *PriorityQueue[T]) pathTo(index int) []int {
 	if index <= 1 {
 		return nil
@@ -0,0 +1,455 @@
+package priorityQueueByLinkedList
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func checkHeap[T comparable](t *testing.T, p *PriorityQueue[T]) {
+	t.Helper()
+
+	if len(p.nodes) != p.size {
+		t.Fatalf("nodes map size=%d, want=%d", len(p.nodes), p.size)
+	}
+	for i := 1; i <= p.size; i++ {
+		n := p.nodeAt(i)
+		if n == nil {
+			t.Fatalf("missing node at index %d", i)
+		}
+		if p.nodes[n.pair.value] != n {
+			t.Fatalf("nodes[%v] does not point at its node", n.pair.value)
+		}
+		if n.parent != nil && p.higher(n.pair.priority, n.parent.pair.priority) {
+			t.Fatalf("heap violated at index %d: %v > parent %v", i, n.pair.priority, n.parent.pair.priority)
+		}
+	}
+}
+
+func TestIndexMapStaysConsistent(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(1))
+	p := NewPriorityQueue[int](3)
+	for i := 0; i < 300; i++ {
+		if err := p.Insert(i, float64(rng.Intn(1000))); err != nil {
+			t.Fatalf("Insert: %v", err)
+		}
+	}
+	checkHeap(t, p)
+
+	for i := 0; i < 2000; i++ {
+		if err := p.Update(rng.Intn(300), float64(rng.Intn(1000))); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+	checkHeap(t, p)
+
+	for i := 0; i < 300; i += 3 {
+		if err := p.Remove(i); err != nil {
+			t.Fatalf("Remove(%d): %v", i, err)
+		}
+		if err := p.Remove(i); err != ErrNotFound {
+			t.Fatalf("second Remove(%d): err=%v, want=%v", i, err, ErrNotFound)
+		}
+	}
+	checkHeap(t, p)
+
+	prev, _ := p.Top()
+	for p.size > 0 {
+		cur, _ := p.Top()
+		if cur.priority > prev.priority {
+			t.Fatalf("order violated: %v after %v", cur.priority, prev.priority)
+		}
+		prev = cur
+	}
+	if len(p.nodes) != 0 {
+		t.Fatalf("nodes map not empty after draining: %d", len(p.nodes))
+	}
+}
+
+func TestInsertRejectsDuplicates(t *testing.T) {
+	t.Parallel()
+
+	p := NewPriorityQueue[string](2)
+	_ = p.Insert("a", 1)
+	if err := p.Insert("a", 2); err != ErrExists {
+		t.Fatalf("err=%v, want=%v", err, ErrExists)
+	}
+	checkHeap(t, p)
+}
+
+func benchmarkQueue(n int) *PriorityQueue[int] {
+	rng := rand.New(rand.NewSource(42))
+	p := NewPriorityQueue[int](4)
+	for i := 0; i < n; i++ {
+		_ = p.Insert(i, rng.Float64())
+	}
+	return p
+}
+
+func BenchmarkUpdate(b *testing.B) {
+	p := benchmarkQueue(10_000)
+	rng := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = p.Update(rng.Intn(10_000), rng.Float64())
+	}
+}
+
+// BenchmarkLinearLookup measures the per-index scan Update used before the
+// nodes map was added.
+func BenchmarkLinearLookup(b *testing.B) {
+	p := benchmarkQueue(10_000)
+	rng := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		target := rng.Intn(10_000)
+		for j := 1; j <= p.size; j++ {
+			if p.nodeAt(j).pair.value == target {
+				break
+			}
+		}
+	}
+}
+
+func TestLenTracksMutations(t *testing.T) {
+	t.Parallel()
+
+	p := NewPriorityQueue[int](2)
+	if p.Len() != 0 || !p.IsEmpty() {
+		t.Fatalf("new queue: Len=%d IsEmpty=%v", p.Len(), p.IsEmpty())
+	}
+
+	_ = p.Insert(1, 1)
+	if p.Len() != 1 || p.IsEmpty() {
+		t.Fatalf("one element: Len=%d IsEmpty=%v", p.Len(), p.IsEmpty())
+	}
+	_, _ = p.Top()
+	if p.Len() != 0 || !p.IsEmpty() {
+		t.Fatalf("after single Top: Len=%d", p.Len())
+	}
+
+	_ = p.Insert(1, 1)
+	_ = p.Remove(1)
+	if p.Len() != 0 {
+		t.Fatalf("after single Remove: Len=%d", p.Len())
+	}
+	if err := p.Remove(1); err != ErrEmpty || p.Len() != 0 {
+		t.Fatalf("Remove on empty: err=%v Len=%d", err, p.Len())
+	}
+
+	want := 0
+	for i := 0; i < 50; i++ {
+		_ = p.Insert(i, float64(i%7))
+		want++
+		if i%3 == 0 {
+			_ = p.Remove(i)
+			want--
+		}
+		if i%5 == 0 {
+			if _, err := p.Top(); err == nil {
+				want--
+			}
+		}
+		if p.Len() != want {
+			t.Fatalf("step %d: Len=%d, want=%d", i, p.Len(), want)
+		}
+	}
+
+	for !p.IsEmpty() {
+		last := p.nodeAt(p.Len())
+		_ = p.Remove(last.pair.value)
+		want--
+		if p.Len() != want {
+			t.Fatalf("removing last: Len=%d, want=%d", p.Len(), want)
+		}
+	}
+	checkHeap(t, p)
+}
+
+func TestContainsAndPriorityOf(t *testing.T) {
+	t.Parallel()
+
+	p := NewPriorityQueue[string](3)
+	for i, v := range []string{"a", "b", "c", "d", "e"} {
+		_ = p.Insert(v, float64(i))
+	}
+	_ = p.Remove("b")
+	_ = p.Update("c", 9.5)
+	_, _ = p.Top()
+
+	for _, absent := range []string{"b", "c", "zzz"} {
+		if p.Contains(absent) {
+			t.Fatalf("Contains(%q)=true", absent)
+		}
+		if _, err := p.PriorityOf(absent); err != ErrNotFound {
+			t.Fatalf("PriorityOf(%q): err=%v, want=%v", absent, err, ErrNotFound)
+		}
+	}
+	for v, want := range map[string]float64{"a": 0, "d": 3, "e": 4} {
+		if !p.Contains(v) {
+			t.Fatalf("Contains(%q)=false", v)
+		}
+		if got, err := p.PriorityOf(v); err != nil || got != want {
+			t.Fatalf("PriorityOf(%q)=%v,%v want %v", v, got, err, want)
+		}
+	}
+}
+
+func TestNewFromSliceBuildsValidHeap(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(2))
+	for _, d := range []int{2, 3, 5} {
+		for _, n := range []int{0, 1, 2, 7, 200} {
+			pairs := make([]Pair[int], n)
+			for i := range pairs {
+				pairs[i] = NewPair(i, float64(rng.Intn(100)))
+			}
+
+			p := NewFromSlice(d, pairs)
+			if p.Len() != n {
+				t.Fatalf("d=%d n=%d: Len=%d", d, n, p.Len())
+			}
+			checkHeap(t, p)
+			for i := 1; i <= n; i++ {
+				if i > 1 {
+					parent, childIdx := p.insertionParentAndIdx(i)
+					if parent.childes[childIdx] != p.nodeAt(i) {
+						t.Fatalf("d=%d n=%d: layout mismatch at %d", d, n, i)
+					}
+				}
+			}
+
+			_ = p.Insert(-1, 1000)
+			checkHeap(t, p)
+			if top, _ := p.Top(); top.Value() != -1 {
+				t.Fatalf("Top=%v after Insert, want -1", top.Value())
+			}
+			checkHeap(t, p)
+		}
+	}
+}
+
+func TestNewFromSliceDuplicatesLastWins(t *testing.T) {
+	t.Parallel()
+
+	p := NewFromSlice(2, []Pair[string]{NewPair("a", 1), NewPair("b", 2), NewPair("a", 3)})
+	checkHeap(t, p)
+	if p.Len() != 2 {
+		t.Fatalf("Len=%d, want=2", p.Len())
+	}
+	if got, _ := p.PriorityOf("a"); got != 3 {
+		t.Fatalf("PriorityOf(a)=%v, want=3", got)
+	}
+}
+
+func TestValuesAndEach(t *testing.T) {
+	t.Parallel()
+
+	p := NewPriorityQueue[int](3)
+	if got := p.Values(); len(got) != 0 {
+		t.Fatalf("empty Values=%v", got)
+	}
+
+	want := make(map[int]bool)
+	for i := 0; i < 40; i++ {
+		_ = p.Insert(i*3, float64((i*17)%11))
+		want[i*3] = true
+	}
+	_ = p.Remove(9)
+	delete(want, 9)
+
+	got := p.Values()
+	if len(got) != len(want) {
+		t.Fatalf("Values len=%d, want=%d", len(got), len(want))
+	}
+	for i, v := range got {
+		if !want[v] {
+			t.Fatalf("unexpected value %d", v)
+		}
+		if n := p.nodeAt(i + 1); n.pair.value != v {
+			t.Fatalf("Values[%d]=%d, not in heap order", i, v)
+		}
+	}
+	checkHeap(t, p)
+
+	visited := 0
+	p.Each(func(int, float64) bool {
+		visited++
+		return visited < 5
+	})
+	if visited != 5 {
+		t.Fatalf("early stop visited %d, want 5", visited)
+	}
+}
+
+func TestMinPriorityQueueTopReturnsMin(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(3))
+	p := NewMinPriorityQueue[int](3)
+	for i := 0; i < 150; i++ {
+		_ = p.Insert(i, float64(rng.Intn(500)))
+	}
+	checkHeap(t, p)
+
+	for i := 0; i < 150; i += 7 {
+		_ = p.Update(i, float64(rng.Intn(500)))
+		checkHeap(t, p)
+	}
+	for i := 1; i < 150; i += 9 {
+		_ = p.Remove(i)
+		checkHeap(t, p)
+	}
+	if tree := p.AsciiTree(); tree == "(empty)\n" {
+		t.Fatalf("AsciiTree rendered an empty tree")
+	}
+
+	prev := -1.0
+	for !p.IsEmpty() {
+		top, _ := p.Top()
+		if top.priority < prev {
+			t.Fatalf("min order violated: %v after %v", top.priority, prev)
+		}
+		prev = top.priority
+	}
+}
+
+func TestClearAndRefill(t *testing.T) {
+	t.Parallel()
+
+	p := NewPriorityQueue[int](2)
+	for i := 0; i < 20; i++ {
+		_ = p.Insert(i, float64(i))
+	}
+
+	p.Clear()
+	if p.Len() != 0 || p.root != nil || len(p.nodes) != 0 {
+		t.Fatalf("Clear left state: Len=%d root=%v nodes=%d", p.Len(), p.root, len(p.nodes))
+	}
+	if _, err := p.Top(); err != ErrEmpty {
+		t.Fatalf("Top after Clear: err=%v, want=%v", err, ErrEmpty)
+	}
+	if p.Contains(5) {
+		t.Fatalf("stale node reachable after Clear")
+	}
+
+	for i := 100; i < 105; i++ {
+		if err := p.Insert(i, float64(i)); err != nil {
+			t.Fatalf("Insert after Clear: %v", err)
+		}
+	}
+	if err := p.Insert(5, 1); err != nil {
+		t.Fatalf("re-inserting cleared value: %v", err)
+	}
+	checkHeap(t, p)
+	if got := p.Values(); len(got) != 6 {
+		t.Fatalf("Values after refill=%v", got)
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	t.Parallel()
+
+	p := NewMinPriorityQueue[int](3)
+	for i := 0; i < 30; i++ {
+		_ = p.Insert(i, float64((i*11)%30))
+	}
+	before := p.Values()
+
+	c := p.Clone()
+	checkHeap(t, c)
+	if c.Len() != p.Len() || c.sizeD != p.sizeD || c.minOrder != p.minOrder {
+		t.Fatalf("clone lost state")
+	}
+	for i := 1; i <= c.Len(); i++ {
+		if c.nodeAt(i) == p.nodeAt(i) {
+			t.Fatalf("clone shares node at index %d", i)
+		}
+	}
+
+	_ = c.Update(3, -100)
+	_ = c.Insert(99, 0)
+	for !c.IsEmpty() {
+		_, _ = c.Top()
+	}
+
+	checkHeap(t, p)
+	if got := p.Values(); len(got) != len(before) {
+		t.Fatalf("original changed: %v", got)
+	}
+	for i, v := range p.Values() {
+		if v != before[i] {
+			t.Fatalf("original order changed at %d", i)
+		}
+	}
+	if pr, _ := p.PriorityOf(3); pr != 3 {
+		t.Fatalf("original priority changed: %v", pr)
+	}
+}
+
+func TestTopKeepsHeapAfterDeepPushDowns(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(4))
+	for _, d := range []int{2, 3, 4} {
+		p := NewPriorityQueue[int](d)
+		for i := 0; i < 1000; i++ {
+			_ = p.Insert(i, rng.Float64())
+		}
+		for !p.IsEmpty() {
+			if _, err := p.Top(); err != nil {
+				t.Fatalf("Top: %v", err)
+			}
+			if p.Len()%50 == 0 {
+				checkHeap(t, p)
+			}
+		}
+	}
+}
+
+func TestMergeCombinesQueues(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(5))
+	a := NewPriorityQueue[int](2)
+	b := NewPriorityQueue[int](4)
+	for i := 0; i < 40; i++ {
+		_ = a.Insert(i, float64(rng.Intn(100)))
+		_ = b.Insert(i+100, float64(rng.Intn(100)))
+	}
+
+	if err := a.Merge(b); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+	checkHeap(t, a)
+	checkHeap(t, b)
+	if a.Len() != 80 || b.Len() != 40 {
+		t.Fatalf("Len a=%d b=%d", a.Len(), b.Len())
+	}
+	for i := 0; i < 40; i++ {
+		if !a.Contains(i) || !a.Contains(i+100) {
+			t.Fatalf("merged queue misses %d or %d", i, i+100)
+		}
+	}
+
+	empty := NewPriorityQueue[int](3)
+	if err := empty.Merge(b); err != nil || empty.Len() != 40 {
+		t.Fatalf("Merge into empty: err=%v Len=%d", err, empty.Len())
+	}
+	checkHeap(t, empty)
+	if err := b.Merge(NewPriorityQueue[int](2)); err != nil || b.Len() != 40 {
+		t.Fatalf("Merge empty: err=%v Len=%d", err, b.Len())
+	}
+	checkHeap(t, b)
+
+	c := NewPriorityQueue[int](2)
+	_ = c.Insert(5, 1)
+	if err := a.Merge(c); err != ErrExists {
+		t.Fatalf("collision: err=%v, want=%v", err, ErrExists)
+	}
+	if a.Len() != 80 {
+		t.Fatalf("failed Merge changed Len to %d", a.Len())
+	}
+}
@@ -0,0 +1,73 @@
+package priorityQueue
+
+import (
+	"algorithms/internal/priorityQueue/priorityQueueByArray"
+	"algorithms/internal/priorityQueue/priorityQueueByLinkedList"
+	"testing"
+)
+
+var (
+	_ PriorityQueue[string, float64, priorityQueueByArray.PairOf[string, float64]] = (*priorityQueueByArray.PriorityQueueOf[string, float64])(nil)
+	_ PriorityQueue[string, float32, priorityQueueByArray.Pair[string]]            = (*priorityQueueByArray.PriorityQueue[string])(nil)
+	_ PriorityQueue[string, float64, priorityQueueByLinkedList.Pair[string]]       = (*priorityQueueByLinkedList.PriorityQueue[string])(nil)
+)
+
+// exercise drives q only through the interface and returns the values in Top
+// order.
+func exercise[E Entry[string, float64]](t *testing.T, q PriorityQueue[string, float64, E]) []string {
+	t.Helper()
+
+	for i, v := range []string{"a", "b", "c", "d", "e"} {
+		if err := q.Insert(v, float64(i)); err != nil {
+			t.Fatalf("Insert(%q): %v", v, err)
+		}
+	}
+	if err := q.Insert("a", 9); err == nil {
+		t.Fatalf("duplicate Insert succeeded")
+	}
+	if err := q.Update("a", 10); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := q.Remove("c"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if err := q.Remove("c"); err == nil {
+		t.Fatalf("Remove of absent element succeeded")
+	}
+
+	if top, err := q.Peek(); err != nil || top.Value() != "a" || top.Priority() != 10 {
+		t.Fatalf("Peek = %v, %v, want a with priority 10", top, err)
+	}
+	if q.Len() != 4 {
+		t.Fatalf("Len=%d, want 4", q.Len())
+	}
+
+	order := make([]string, 0, q.Len())
+	for q.Len() > 0 {
+		top, err := q.Top()
+		if err != nil {
+			t.Fatalf("Top: %v", err)
+		}
+		order = append(order, top.Value())
+	}
+	if _, err := q.Top(); err == nil {
+		t.Fatalf("Top on empty queue succeeded")
+	}
+	return order
+}
+
+func TestBothImplementationsThroughInterface(t *testing.T) {
+	t.Parallel()
+
+	byArray := exercise[priorityQueueByArray.PairOf[string, float64]](t,
+		priorityQueueByArray.NewPriorityQueueOf[string, float64](3, 0))
+	byList := exercise[priorityQueueByLinkedList.Pair[string]](t,
+		priorityQueueByLinkedList.NewPriorityQueue[string](3))
+
+	want := []string{"a", "e", "d", "b"}
+	for i := range want {
+		if byArray[i] != want[i] || byList[i] != want[i] {
+			t.Fatalf("array order %v, linked-list order %v, want %v", byArray, byList, want)
+		}
+	}
+}
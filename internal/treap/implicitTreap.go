@@ -0,0 +1,155 @@
+package treap
+
+import (
+	"math/rand"
+)
+
+// ImplicitTreap is a sequence ordered by position instead of by key. Nodes are
+// ordered by their in-order index, derived from subtree sizes, so inserting or
+// removing at any index costs O(log n) expected time. Values are never
+// compared, so T may be any type.
+type ImplicitTreap[T any] struct {
+	root *implicitNode[T]
+	rng  *rand.Rand
+}
+
+// implicitNode is the node of an ImplicitTreap. It keeps the min-heap order on
+// priority like Node, but has no key and no parent pointer: every operation
+// goes through split and merge from the root.
+type implicitNode[T any] struct {
+	value    T
+	priority float64
+	size     int
+	left     *implicitNode[T]
+	right    *implicitNode[T]
+}
+
+// NewImplicitTreap returns an empty sequence whose priorities are drawn from a
+// generator seeded with seed. The zero value is also ready to use and draws
+// priorities from the global generator.
+func NewImplicitTreap[T any](seed int64) *ImplicitTreap[T] {
+	return &ImplicitTreap[T]{rng: rand.New(rand.NewSource(seed))}
+}
+
+func (t *ImplicitTreap[T]) Len() int {
+	return t.root.Size()
+}
+
+// InsertAt inserts value so that it ends up at index i, shifting later
+// elements right. i may equal Len to append.
+func (t *ImplicitTreap[T]) InsertAt(i int, value T) error {
+	if i < 0 || i > t.root.Size() {
+		return ErrOutOfRange
+	}
+	var priority float64
+	if t.rng != nil {
+		priority = t.rng.Float64()
+	} else {
+		priority = rand.Float64()
+	}
+	left, right := t.root.split(i)
+	node := &implicitNode[T]{value: value, priority: priority, size: 1}
+	t.root = mergeImplicit(mergeImplicit(left, node), right)
+	return nil
+}
+
+// RemoveAt removes and returns the element at index i.
+func (t *ImplicitTreap[T]) RemoveAt(i int) (T, error) {
+	var zero T
+	if i < 0 || i >= t.root.Size() {
+		return zero, ErrOutOfRange
+	}
+	left, rest := t.root.split(i)
+	node, right := rest.split(1)
+	t.root = mergeImplicit(left, right)
+	return node.value, nil
+}
+
+// Get returns the element at index i.
+func (t *ImplicitTreap[T]) Get(i int) (T, error) {
+	var zero T
+	if i < 0 || i >= t.root.Size() {
+		return zero, ErrOutOfRange
+	}
+	return t.root.at(i).value, nil
+}
+
+// Values returns the elements in sequence order.
+func (t *ImplicitTreap[T]) Values() []T {
+	values := make([]T, 0, t.root.Size())
+	t.root.inOrder(func(n *implicitNode[T]) {
+		values = append(values, n.value)
+	})
+	return values
+}
+
+func (n *implicitNode[T]) Size() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *implicitNode[T]) updateSize() {
+	n.size = 1 + n.left.Size() + n.right.Size()
+}
+
+// split moves the first k nodes of the subtree into left and the rest into
+// right.
+func (n *implicitNode[T]) split(k int) (left, right *implicitNode[T]) {
+	if n == nil {
+		return nil, nil
+	}
+	if leftSize := n.left.Size(); leftSize < k {
+		n.right, right = n.right.split(k - leftSize - 1)
+		n.updateSize()
+		return n, right
+	}
+	left, n.left = n.left.split(k)
+	n.updateSize()
+	return left, n
+}
+
+// mergeImplicit joins two sequences, every element of left preceding every
+// element of right.
+func mergeImplicit[T any](left, right *implicitNode[T]) *implicitNode[T] {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	if left.priority <= right.priority {
+		left.right = mergeImplicit(left.right, right)
+		left.updateSize()
+		return left
+	}
+	right.left = mergeImplicit(left, right.left)
+	right.updateSize()
+	return right
+}
+
+// at returns the node at in-order index i, which must be in range.
+func (n *implicitNode[T]) at(i int) *implicitNode[T] {
+	for {
+		leftSize := n.left.Size()
+		switch {
+		case i < leftSize:
+			n = n.left
+		case i == leftSize:
+			return n
+		default:
+			i -= leftSize + 1
+			n = n.right
+		}
+	}
+}
+
+func (n *implicitNode[T]) inOrder(visit func(*implicitNode[T])) {
+	if n == nil {
+		return
+	}
+	n.left.inOrder(visit)
+	visit(n)
+	n.right.inOrder(visit)
+}
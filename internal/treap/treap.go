@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"golang.org/x/exp/constraints"
+	"math/rand"
 	"strings"
 )
 
@@ -13,15 +14,26 @@ var (
 	ErrNotLeftChild  = errors.New("treap: node is not left child")
 	ErrNotRightChild = errors.New("treap: node is not right child")
 	ErrNotFound      = errors.New("treap: node not found")
+	ErrNotSorted     = errors.New("treap: keys are not sorted")
+	ErrSizeMismatch  = errors.New("treap: keys and priorities differ in length")
+	ErrOutOfRange    = errors.New("treap: rank out of range")
+	ErrDuplicateKey  = errors.New("treap: duplicate key")
+	ErrInvalidTreap  = errors.New("treap: invariants violated")
 )
 
 type Treap[T constraints.Ordered] struct {
 	root *Node[T]
+	rng  *rand.Rand
+	// seed and draws identify the state of rng without reading it, so Clone
+	// can derive a new generator without advancing this one.
+	seed  int64
+	draws uint64
 }
 
 type Node[T constraints.Ordered] struct {
 	key      T
 	priority float64
+	size     int
 	left     *Node[T]
 	right    *Node[T]
 	parent   *Node[T]
@@ -31,8 +43,90 @@ func NewTreap[T constraints.Ordered]() *Treap[T] {
 	return &Treap[T]{}
 }
 
+// NewTreapWithSeed returns a treap whose InsertKey draws priorities from a
+// generator seeded with seed, so the resulting shape is reproducible.
+func NewTreapWithSeed[T constraints.Ordered](seed int64) *Treap[T] {
+	return &Treap[T]{rng: rand.New(rand.NewSource(seed)), seed: seed}
+}
+
+// BuildFromSorted builds a treap from strictly increasing keys and their
+// priorities in O(n) using the Cartesian-tree stack construction. Parent
+// pointers are wired as nodes are linked, so the result supports rotations
+// immediately.
+func BuildFromSorted[T constraints.Ordered](keys []T, priorities []float64) (*Treap[T], error) {
+	if len(keys) != len(priorities) {
+		return nil, ErrSizeMismatch
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i] < keys[i-1] {
+			return nil, ErrNotSorted
+		}
+		if keys[i] == keys[i-1] {
+			return nil, ErrDuplicateKey
+		}
+	}
+
+	stack := make([]*Node[T], 0)
+	for i, key := range keys {
+		node := NewNode(key, priorities[i])
+		var last *Node[T]
+		for len(stack) > 0 && stack[len(stack)-1].priority > node.priority {
+			last = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			last.updateSize()
+		}
+		node.setLeft(last)
+		if len(stack) > 0 {
+			stack[len(stack)-1].setRight(node)
+		}
+		stack = append(stack, node)
+	}
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		stack[i].updateSize()
+	}
+
+	t := NewTreap[T]()
+	if len(stack) > 0 {
+		t.root = stack[0]
+		t.root.parent = nil
+	}
+	return t, nil
+}
+
+// BuildSortedTreap builds a treap from strictly increasing keys in O(n), drawing
+// random priorities from a generator seeded with seed. The generator is kept
+// for later InsertKey calls, as with NewTreapWithSeed.
+func BuildSortedTreap[T constraints.Ordered](keys []T, seed int64) (*Treap[T], error) {
+	rng := rand.New(rand.NewSource(seed))
+	priorities := make([]float64, len(keys))
+	for i := range priorities {
+		priorities[i] = rng.Float64()
+	}
+
+	t, err := BuildFromSorted(keys, priorities)
+	if err != nil {
+		return nil, err
+	}
+	t.rng = rng
+	t.seed = seed
+	t.draws = uint64(len(keys))
+	return t, nil
+}
+
 func NewNode[T constraints.Ordered](key T, priority float64) *Node[T] {
-	return &Node[T]{key: key, priority: priority}
+	return &Node[T]{key: key, priority: priority, size: 1}
+}
+
+func (n *Node[T]) Size() int {
+	if n == nil {
+		return 0
+	}
+	return n.size
+}
+
+func (n *Node[T]) updateSize() {
+	n.size = 1 + n.left.Size() + n.right.Size()
 }
 
 func (n *Node[T]) setLeft(node *Node[T]) {
@@ -79,6 +173,8 @@ func (t *Treap[T]) rightRotate(x *Node[T]) error {
 
 	y.setLeft(x.right)
 	x.setRight(y)
+	y.updateSize()
+	x.updateSize()
 
 	return nil
 }
@@ -113,9 +209,14 @@ func (t *Treap[T]) leftRotate(x *Node[T]) error {
 
 	y.setRight(x.left)
 	x.setLeft(y)
+	y.updateSize()
+	x.updateSize()
 	return nil
 }
 
+// Insert adds key with the given priority. Keys are unique: inserting a key
+// that is already present returns ErrDuplicateKey and leaves the treap
+// unchanged.
 func (t *Treap[T]) Insert(key T, priority float64) error {
 	newNode := NewNode(key, priority)
 
@@ -130,8 +231,10 @@ func (t *Treap[T]) Insert(key T, priority float64) error {
 		parent = node
 		if key < node.key {
 			node = node.left
-		} else {
+		} else if node.key < key {
 			node = node.right
+		} else {
+			return ErrDuplicateKey
 		}
 	}
 
@@ -140,6 +243,9 @@ func (t *Treap[T]) Insert(key T, priority float64) error {
 	} else {
 		parent.setRight(newNode)
 	}
+	for n := parent; n != nil; n = n.parent {
+		n.size++
+	}
 
 	for newNode.parent != nil && newNode.priority < newNode.parent.priority {
 		if newNode == newNode.parent.left {
@@ -159,41 +265,47 @@ func (t *Treap[T]) Insert(key T, priority float64) error {
 	return nil
 }
 
-func (t *Treap[T]) Remove(key T) bool {
-	node := t.root
-	for node != nil && node.key != key {
-		if key < node.key {
-			node = node.left
-		} else {
-			node = node.right
-		}
+// InsertKey inserts key with a random priority, which keeps the expected
+// height O(log n) for any insertion order. Keys already present are left
+// untouched. Treaps not created with NewTreapWithSeed use the global
+// generator.
+func (t *Treap[T]) InsertKey(key T) {
+	var priority float64
+	if t.rng != nil {
+		priority = t.rng.Float64()
+		t.draws++
+	} else {
+		priority = rand.Float64()
 	}
+	_ = t.Insert(key, priority)
+}
+
+// Remove deletes key. The node is replaced by the merge of its children, which
+// keeps the min-heap order without rotations, so the operation cannot fail
+// halfway and leave the tree partially restructured.
+func (t *Treap[T]) Remove(key T) bool {
+	node := t.root.Search(key)
 	if node == nil {
 		return false
 	}
 
-	for !node.isLeaf() {
-		if node.left != nil && (node.right == nil || node.left.priority <= node.right.priority) {
-			if err := t.rightRotate(node.left); err != nil {
-				return false
-			}
-		} else {
-			if err := t.leftRotate(node.right); err != nil {
-				return false
-			}
+	parent := node.parent
+	child := merge(node.left, node.right)
+	switch {
+	case parent == nil:
+		t.root = child
+		if child != nil {
+			child.parent = nil
 		}
+	case parent.left == node:
+		parent.setLeft(child)
+	default:
+		parent.setRight(child)
 	}
-
-	if node.parent == nil {
-		t.root = nil
-		return true
-	}
-	if node.parent.left == node {
-		node.parent.left = nil
-	} else {
-		node.parent.right = nil
+	for n := parent; n != nil; n = n.parent {
+		n.size--
 	}
-	node.parent = nil
+	node.left, node.right, node.parent = nil, nil, nil
 
 	return true
 }
@@ -268,6 +380,384 @@ func (t *Treap[T]) Update(key T, priority float64) error {
 	return nil
 }
 
+// ReshufflePriorities assigns fresh random priorities to every key and rebuilds
+// the treap in O(n) from the in-order key sequence.
+func (t *Treap[T]) ReshufflePriorities(seed int64) {
+	rng := rand.New(rand.NewSource(seed))
+	keys := make([]T, 0)
+	priorities := make([]float64, 0)
+	t.root.inOrder(func(n *Node[T]) bool {
+		keys = append(keys, n.key)
+		priorities = append(priorities, rng.Float64())
+		return true
+	})
+
+	rebuilt, _ := BuildFromSorted(keys, priorities)
+	t.root = rebuilt.root
+}
+
+// Keys returns all keys in ascending order.
+func (t *Treap[T]) Keys() []T {
+	keys := make([]T, 0, t.root.Size())
+	t.root.inOrder(func(n *Node[T]) bool {
+		keys = append(keys, n.key)
+		return true
+	})
+	return keys
+}
+
+// InOrder calls fn for every key and its priority in ascending key order until
+// fn returns false.
+func (t *Treap[T]) InOrder(fn func(key T, priority float64) bool) {
+	t.root.inOrder(func(n *Node[T]) bool {
+		return fn(n.key, n.priority)
+	})
+}
+
+// TopLevels returns the keys of the first maxDepth levels, level by level and
+// left to right within a level. Deeper nodes are never visited.
+func (t *Treap[T]) TopLevels(maxDepth int) [][]T {
+	levels := make([][]T, 0)
+	level := make([]*Node[T], 0)
+	if t.root != nil {
+		level = append(level, t.root)
+	}
+	for depth := 0; depth < maxDepth && len(level) > 0; depth++ {
+		keys := make([]T, 0, len(level))
+		next := make([]*Node[T], 0, 2*len(level))
+		for _, n := range level {
+			keys = append(keys, n.key)
+			if n.left != nil {
+				next = append(next, n.left)
+			}
+			if n.right != nil {
+				next = append(next, n.right)
+			}
+		}
+		levels = append(levels, keys)
+		level = next
+	}
+	return levels
+}
+
+// Size returns the number of keys in O(1) from the root's subtree size.
+func (t *Treap[T]) Size() int {
+	return t.root.Size()
+}
+
+// Clone returns a deep copy of the treap. A seeded treap hands the copy a
+// generator seeded from the source's seed and draw count: Clone never advances
+// the source's generator, the copy does not replay priorities the source has
+// already used, and clones taken at the same point draw the same priorities.
+func (t *Treap[T]) Clone() *Treap[T] {
+	c := &Treap[T]{root: t.root.clone(nil)}
+	if t.rng != nil {
+		c.seed = deriveSeed(t.seed, t.draws)
+		c.rng = rand.New(rand.NewSource(c.seed))
+	}
+	return c
+}
+
+// deriveSeed mixes seed and draws with the splitmix64 finalizer, so each
+// generator state maps to an unrelated seed.
+func deriveSeed(seed int64, draws uint64) int64 {
+	z := uint64(seed) + (draws+1)*0x9e3779b97f4a7c15
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return int64(z ^ z>>31)
+}
+
+// Clear removes every key. The treap keeps its priority generator.
+func (t *Treap[T]) Clear() {
+	t.root = nil
+}
+
+// Height returns the number of nodes on the longest root-to-leaf path, 0 for
+// an empty treap. It visits every node.
+func (t *Treap[T]) Height() int {
+	return t.root.height()
+}
+
+func (n *Node[T]) height() int {
+	if n == nil {
+		return 0
+	}
+	return 1 + max(n.left.height(), n.right.height())
+}
+
+func (t *Treap[T]) RootChildren() (left T, hasLeft bool, right T, hasRight bool) {
+	if t.root == nil {
+		return
+	}
+	if t.root.left != nil {
+		left, hasLeft = t.root.left.key, true
+	}
+	if t.root.right != nil {
+		right, hasRight = t.root.right.key, true
+	}
+	return
+}
+
+// KeysByRankRange returns the keys whose 0-based rank lies in
+// [startRank, endRank), clamped to the treap. Subtrees outside the range are
+// skipped using their sizes, so the cost is O(log n + k).
+func (t *Treap[T]) KeysByRankRange(startRank, endRank int) []T {
+	if startRank < 0 {
+		startRank = 0
+	}
+	if endRank > t.root.Size() {
+		endRank = t.root.Size()
+	}
+	keys := make([]T, 0, max(endRank-startRank, 0))
+	t.root.collectRanks(0, startRank, endRank, &keys)
+	return keys
+}
+
+func (n *Node[T]) collectRanks(offset, startRank, endRank int, keys *[]T) {
+	if n == nil || offset >= endRank || offset+n.size <= startRank {
+		return
+	}
+	rank := offset + n.left.Size()
+	n.left.collectRanks(offset, startRank, endRank, keys)
+	if rank >= startRank && rank < endRank {
+		*keys = append(*keys, n.key)
+	}
+	n.right.collectRanks(rank+1, startRank, endRank, keys)
+}
+
+// RangeKeys returns the keys in [lo, hi] in ascending order, skipping
+// subtrees that lie entirely outside the range.
+func (t *Treap[T]) RangeKeys(lo, hi T) []T {
+	keys := make([]T, 0)
+	t.root.collectRange(lo, hi, &keys)
+	return keys
+}
+
+func (n *Node[T]) collectRange(lo, hi T, keys *[]T) {
+	if n == nil {
+		return
+	}
+	if lo < n.key {
+		n.left.collectRange(lo, hi, keys)
+	}
+	if lo <= n.key && n.key <= hi {
+		*keys = append(*keys, n.key)
+	}
+	if n.key <= hi {
+		n.right.collectRange(lo, hi, keys)
+	}
+}
+
+// RangeCount returns the number of keys in [lo, hi] in O(log n) expected
+// time using subtree sizes.
+func (t *Treap[T]) RangeCount(lo, hi T) int {
+	if hi < lo {
+		return 0
+	}
+	return t.root.countBelow(hi, true) - t.root.countBelow(lo, false)
+}
+
+// countBelow counts the keys < key, or <= key when inclusive is set.
+func (n *Node[T]) countBelow(key T, inclusive bool) int {
+	count := 0
+	for n != nil {
+		if n.key < key || (inclusive && n.key == key) {
+			count += n.left.Size() + 1
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	return count
+}
+
+// Kth returns the k-th smallest key, 1-indexed, in O(log n) expected time.
+func (t *Treap[T]) Kth(k int) (T, error) {
+	var zero T
+	if k < 1 || k > t.root.Size() {
+		return zero, ErrOutOfRange
+	}
+	return t.root.at(k - 1).key, nil
+}
+
+// at returns the node at 0-based in-order position i, which must be in range.
+func (n *Node[T]) at(i int) *Node[T] {
+	for {
+		leftSize := n.left.Size()
+		switch {
+		case i < leftSize:
+			n = n.left
+		case i == leftSize:
+			return n
+		default:
+			i -= leftSize + 1
+			n = n.right
+		}
+	}
+}
+
+// KthLargest returns the k-th largest key, 1-indexed.
+func (t *Treap[T]) KthLargest(k int) (T, error) {
+	if k < 1 {
+		var zero T
+		return zero, ErrOutOfRange
+	}
+	return t.Kth(t.root.Size() - k + 1)
+}
+
+// Rank returns the 1-indexed position of key in sorted order, so that
+// Kth(Rank(key)) == key.
+func (t *Treap[T]) Rank(key T) (int, error) {
+	rank := 0
+	node := t.root
+	for node != nil {
+		if key < node.key {
+			node = node.left
+		} else if node.key < key {
+			rank += node.left.Size() + 1
+			node = node.right
+		} else {
+			return rank + node.left.Size() + 1, nil
+		}
+	}
+	return 0, ErrNotFound
+}
+
+// Successor returns the smallest key strictly greater than key. The key does
+// not have to be present in the treap.
+func (t *Treap[T]) Successor(key T) (T, bool) {
+	node := t.root.Search(key)
+	if node != nil {
+		node = node.next()
+	} else {
+		node = t.root.firstAbove(key)
+	}
+	if node == nil {
+		var zero T
+		return zero, false
+	}
+	return node.key, true
+}
+
+// Predecessor returns the largest key strictly smaller than key. The key does
+// not have to be present in the treap.
+func (t *Treap[T]) Predecessor(key T) (T, bool) {
+	node := t.root.Search(key)
+	if node != nil {
+		node = node.prev()
+	} else {
+		node = t.root.lastBelow(key)
+	}
+	if node == nil {
+		var zero T
+		return zero, false
+	}
+	return node.key, true
+}
+
+// Floor returns the largest key less than or equal to key.
+func (t *Treap[T]) Floor(key T) (T, bool) {
+	var best T
+	found := false
+	for node := t.root; node != nil; {
+		if key < node.key {
+			node = node.left
+		} else {
+			best, found = node.key, true
+			node = node.right
+		}
+	}
+	return best, found
+}
+
+// Ceiling returns the smallest key greater than or equal to key.
+func (t *Treap[T]) Ceiling(key T) (T, bool) {
+	var best T
+	found := false
+	for node := t.root; node != nil; {
+		if node.key < key {
+			node = node.right
+		} else {
+			best, found = node.key, true
+			node = node.left
+		}
+	}
+	return best, found
+}
+
+// firstAbove returns the node with the smallest key strictly greater than key.
+func (n *Node[T]) firstAbove(key T) *Node[T] {
+	var best *Node[T]
+	for n != nil {
+		if key < n.key {
+			best = n
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return best
+}
+
+// lastBelow returns the node with the largest key strictly smaller than key.
+func (n *Node[T]) lastBelow(key T) *Node[T] {
+	var best *Node[T]
+	for n != nil {
+		if n.key < key {
+			best = n
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	return best
+}
+
+// next returns the in-order successor of n using parent pointers.
+func (n *Node[T]) next() *Node[T] {
+	if n.right != nil {
+		n = n.right
+		for n.left != nil {
+			n = n.left
+		}
+		return n
+	}
+	for n.parent != nil && n.parent.right == n {
+		n = n.parent
+	}
+	return n.parent
+}
+
+// prev returns the in-order predecessor of n using parent pointers.
+func (n *Node[T]) prev() *Node[T] {
+	if n.left != nil {
+		n = n.left
+		for n.right != nil {
+			n = n.right
+		}
+		return n
+	}
+	for n.parent != nil && n.parent.left == n {
+		n = n.parent
+	}
+	return n.parent
+}
+
+func (t *Treap[T]) DegreeCounts() (leaves, oneChild, twoChildren int) {
+	t.root.inOrder(func(n *Node[T]) bool {
+		switch {
+		case n.left != nil && n.right != nil:
+			twoChildren++
+		case n.left != nil || n.right != nil:
+			oneChild++
+		default:
+			leaves++
+		}
+		return true
+	})
+	return
+}
+
 func (t *Treap[T]) Min() (T, error) {
 	var zero T
 	if t.root == nil {
@@ -296,6 +786,33 @@ func (t *Treap[T]) Max() (T, error) {
 	return node.key, nil
 }
 
+// Contains reports whether key is stored in the treap.
+func (t *Treap[T]) Contains(key T) bool {
+	return t.root.Search(key) != nil
+}
+
+// PriorityOf returns the priority stored for key, or ErrNotFound.
+func (t *Treap[T]) PriorityOf(key T) (float64, error) {
+	node := t.root.Search(key)
+	if node == nil {
+		return 0, ErrNotFound
+	}
+	return node.priority, nil
+}
+
+// IsAncestor reports whether descendant lies strictly below the node holding
+// ancestor. It is false when either key is absent or the keys are equal.
+func (t *Treap[T]) IsAncestor(ancestor, descendant T) bool {
+	node := t.root.Search(ancestor)
+	if node == nil || ancestor == descendant {
+		return false
+	}
+	if descendant < ancestor {
+		return node.left.Search(descendant) != nil
+	}
+	return node.right.Search(descendant) != nil
+}
+
 func (n *Node[T]) Search(targetKey T) *Node[T] {
 	if n == nil {
 		return nil
@@ -312,8 +829,289 @@ func (n *Node[T]) Search(targetKey T) *Node[T] {
 	}
 }
 
-func (n *Node[T]) isLeaf() bool {
-	return n.left == nil && n.right == nil
+// IsBST reports whether in-order keys are strictly increasing, as Insert
+// never stores a key twice.
+func (t *Treap[T]) IsBST() bool {
+	var prev *Node[T]
+	ok := true
+	t.root.inOrder(func(n *Node[T]) bool {
+		if prev != nil && !(prev.key < n.key) {
+			ok = false
+			return false
+		}
+		prev = n
+		return true
+	})
+	return ok
+}
+
+// IsValid reports whether the treap satisfies both the BST order and the
+// min-heap order on priorities, with consistent parent pointers and subtree
+// sizes.
+func (t *Treap[T]) IsValid() bool {
+	return t.Validate() == nil
+}
+
+// Validate checks the BST order, the min-heap order on priorities, parent
+// pointers and subtree sizes, and describes the first violation found. The
+// returned error wraps ErrInvalidTreap.
+func (t *Treap[T]) Validate() error {
+	if t.root != nil && t.root.parent != nil {
+		return fmt.Errorf("%w: root %v has a parent", ErrInvalidTreap, t.root.key)
+	}
+	var prev *Node[T]
+	return t.root.validate(&prev)
+}
+
+// validate checks the subtree in order, so prev is the last key visited.
+func (n *Node[T]) validate(prev **Node[T]) error {
+	if n == nil {
+		return nil
+	}
+	for _, child := range []*Node[T]{n.left, n.right} {
+		if child == nil {
+			continue
+		}
+		if child.parent != n {
+			return fmt.Errorf("%w: child %v of %v has a wrong parent pointer", ErrInvalidTreap, child.key, n.key)
+		}
+		if child.priority < n.priority {
+			return fmt.Errorf("%w: child %v has priority %v below parent %v with %v",
+				ErrInvalidTreap, child.key, child.priority, n.key, n.priority)
+		}
+	}
+	if err := n.left.validate(prev); err != nil {
+		return err
+	}
+	if *prev != nil && !((*prev).key < n.key) {
+		return fmt.Errorf("%w: key %v follows %v in order", ErrInvalidTreap, n.key, (*prev).key)
+	}
+	*prev = n
+	if n.size != 1+n.left.Size()+n.right.Size() {
+		return fmt.Errorf("%w: node %v has size %d, want %d",
+			ErrInvalidTreap, n.key, n.size, 1+n.left.Size()+n.right.Size())
+	}
+	return n.right.validate(prev)
+}
+
+func (n *Node[T]) inOrder(fn func(*Node[T]) bool) bool {
+	if n == nil {
+		return true
+	}
+	return n.left.inOrder(fn) && fn(n) && n.right.inOrder(fn)
+}
+
+// Split moves the keys < key into left and the keys >= key into right in
+// O(log n) expected time. t is left empty.
+func (t *Treap[T]) Split(key T) (left, right *Treap[T]) {
+	l, r := split(t.root, key)
+	t.root = nil
+	return &Treap[T]{root: l}, &Treap[T]{root: r}
+}
+
+// Merge joins two treaps where every key in left is < every key in right.
+// Both inputs are left empty.
+func Merge[T constraints.Ordered](left, right *Treap[T]) *Treap[T] {
+	root := merge(left.root, right.root)
+	if root != nil {
+		root.parent = nil
+	}
+	left.root, right.root = nil, nil
+	return &Treap[T]{root: root}
+}
+
+// VerifySplitMergeRoundTrip splits a copy of the treap at key, merges the
+// halves back and reports whether the result is structurally identical to the
+// original. The treap itself is not modified.
+func (t *Treap[T]) VerifySplitMergeRoundTrip(key T) bool {
+	left, right := split(t.root.clone(nil), key)
+	partitioned := left.inOrder(func(n *Node[T]) bool { return n.key < key }) &&
+		right.inOrder(func(n *Node[T]) bool { return n.key >= key })
+	if !partitioned {
+		return false
+	}
+	merged := merge(left, right)
+	if merged != nil {
+		merged.parent = nil
+	}
+	return t.root.equal(merged)
+}
+
+// Union returns a treap holding the keys of t and other. A key present in
+// both keeps the smaller of its two priorities, t's on a tie. Neither input
+// is modified.
+func (t *Treap[T]) Union(other *Treap[T]) *Treap[T] {
+	return newDetached(union(t.root.clone(nil), other.root.clone(nil)))
+}
+
+// Intersection returns a treap holding the keys present in both t and other,
+// with priorities chosen as in Union. Neither input is modified.
+func (t *Treap[T]) Intersection(other *Treap[T]) *Treap[T] {
+	return newDetached(intersection(t.root.clone(nil), other.root.clone(nil)))
+}
+
+// Difference returns a treap holding the keys of t that are not in other,
+// with their priorities from t. Neither input is modified.
+func (t *Treap[T]) Difference(other *Treap[T]) *Treap[T] {
+	return newDetached(difference(t.root.clone(nil), other.root.clone(nil)))
+}
+
+func newDetached[T constraints.Ordered](root *Node[T]) *Treap[T] {
+	if root != nil {
+		root.parent = nil
+	}
+	return &Treap[T]{root: root}
+}
+
+// The set operations below split the operand with the larger root priority
+// around the other root's key and recurse into both sides, which costs
+// O(m log(n/m)) expected time for sizes m <= n.
+
+func union[T constraints.Ordered](a, b *Node[T]) *Node[T] {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	if b.priority < a.priority {
+		a, b = b, a
+	}
+	l, _, r := split3(b, a.key)
+	a.setLeft(union(a.left, l))
+	a.setRight(union(a.right, r))
+	a.updateSize()
+	return a
+}
+
+func intersection[T constraints.Ordered](a, b *Node[T]) *Node[T] {
+	if a == nil || b == nil {
+		return nil
+	}
+	if b.priority < a.priority {
+		a, b = b, a
+	}
+	l, mid, r := split3(b, a.key)
+	left := intersection(a.left, l)
+	right := intersection(a.right, r)
+	if mid == nil {
+		return merge(left, right)
+	}
+	a.setLeft(left)
+	a.setRight(right)
+	a.updateSize()
+	return a
+}
+
+func difference[T constraints.Ordered](a, b *Node[T]) *Node[T] {
+	if a == nil || b == nil {
+		return a
+	}
+	l, mid, r := split3(b, a.key)
+	left := difference(a.left, l)
+	right := difference(a.right, r)
+	if mid != nil {
+		return merge(left, right)
+	}
+	a.setLeft(left)
+	a.setRight(right)
+	a.updateSize()
+	return a
+}
+
+// split3 partitions the subtree into keys < key, the node holding key (nil if
+// absent) and keys > key. All returned roots have a nil parent.
+func split3[T constraints.Ordered](n *Node[T], key T) (left, mid, right *Node[T]) {
+	if n == nil {
+		return nil, nil, nil
+	}
+	switch {
+	case n.key < key:
+		l, m, r := split3(n.right, key)
+		n.setRight(l)
+		n.updateSize()
+		n.parent = nil
+		return n, m, r
+	case key < n.key:
+		l, m, r := split3(n.left, key)
+		n.setLeft(r)
+		n.updateSize()
+		n.parent = nil
+		return l, m, n
+	}
+	left, right = n.left, n.right
+	if left != nil {
+		left.parent = nil
+	}
+	if right != nil {
+		right.parent = nil
+	}
+	n.left, n.right, n.parent = nil, nil, nil
+	n.size = 1
+	return left, n, right
+}
+
+// split partitions the subtree into keys < key and keys >= key. Both returned
+// roots have a nil parent.
+func split[T constraints.Ordered](n *Node[T], key T) (*Node[T], *Node[T]) {
+	if n == nil {
+		return nil, nil
+	}
+	if n.key < key {
+		left, right := split(n.right, key)
+		n.setRight(left)
+		n.updateSize()
+		if right != nil {
+			right.parent = nil
+		}
+		n.parent = nil
+		return n, right
+	}
+	left, right := split(n.left, key)
+	n.setLeft(right)
+	n.updateSize()
+	if left != nil {
+		left.parent = nil
+	}
+	n.parent = nil
+	return left, n
+}
+
+// merge joins two subtrees where every key in left is < every key in right,
+// keeping the min-heap order on priorities.
+func merge[T constraints.Ordered](left, right *Node[T]) *Node[T] {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	if left.priority <= right.priority {
+		left.setRight(merge(left.right, right))
+		left.updateSize()
+		return left
+	}
+	right.setLeft(merge(left, right.left))
+	right.updateSize()
+	return right
+}
+
+func (n *Node[T]) clone(parent *Node[T]) *Node[T] {
+	if n == nil {
+		return nil
+	}
+	c := &Node[T]{key: n.key, priority: n.priority, size: n.size, parent: parent}
+	c.left = n.left.clone(c)
+	c.right = n.right.clone(c)
+	return c
+}
+
+func (n *Node[T]) equal(other *Node[T]) bool {
+	if n == nil || other == nil {
+		return n == other
+	}
+	return n.key == other.key && n.priority == other.priority &&
+		n.left.equal(other.left) && n.right.equal(other.right)
 }
 
 func (t *Treap[T]) String() string {
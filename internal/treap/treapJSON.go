@@ -0,0 +1,60 @@
+package treap
+
+import (
+	"encoding/json"
+	"golang.org/x/exp/constraints"
+)
+
+// nodeJSON nests children explicitly, so decoding restores the exact shape
+// without replaying the original insertion order.
+type nodeJSON[T constraints.Ordered] struct {
+	Key      T            `json:"key"`
+	Priority float64      `json:"priority"`
+	Left     *nodeJSON[T] `json:"left,omitempty"`
+	Right    *nodeJSON[T] `json:"right,omitempty"`
+}
+
+// MarshalJSON encodes the tree structure, null for an empty treap.
+func (t *Treap[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.root.toJSON())
+}
+
+// UnmarshalJSON restores the tree encoded by MarshalJSON, rewiring parent
+// pointers and subtree sizes. Input that does not form a valid treap returns
+// the Validate error and leaves t unchanged.
+func (t *Treap[T]) UnmarshalJSON(data []byte) error {
+	var in *nodeJSON[T]
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	decoded := &Treap[T]{root: in.toNode()}
+	if err := decoded.Validate(); err != nil {
+		return err
+	}
+	t.root = decoded.root
+	return nil
+}
+
+func (n *Node[T]) toJSON() *nodeJSON[T] {
+	if n == nil {
+		return nil
+	}
+	return &nodeJSON[T]{
+		Key:      n.key,
+		Priority: n.priority,
+		Left:     n.left.toJSON(),
+		Right:    n.right.toJSON(),
+	}
+}
+
+func (j *nodeJSON[T]) toNode() *Node[T] {
+	if j == nil {
+		return nil
+	}
+	n := NewNode(j.Key, j.Priority)
+	n.setLeft(j.Left.toNode())
+	n.setRight(j.Right.toNode())
+	n.updateSize()
+	return n
+}
@@ -0,0 +1,1247 @@
+package treap
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func buildRandomTreap(rng *rand.Rand, n int) (*Treap[int], []int) {
+	tr := NewTreap[int]()
+	seen := make(map[int]bool, n)
+	keys := make([]int, 0, n)
+	for len(keys) < n {
+		k := rng.Intn(n * 10)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		keys = append(keys, k)
+		_ = tr.Insert(k, rng.Float64())
+	}
+	sort.Ints(keys)
+	return tr, keys
+}
+
+func TestRootChildren(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTreap[int]()
+	if _, hl, _, hr := tr.RootChildren(); hl || hr {
+		t.Fatalf("empty treap reports children: left=%v right=%v", hl, hr)
+	}
+
+	_ = tr.Insert(10, 1)
+	if _, hl, _, hr := tr.RootChildren(); hl || hr {
+		t.Fatalf("single node reports children: left=%v right=%v", hl, hr)
+	}
+
+	_ = tr.Insert(5, 2)
+	l, hl, _, hr := tr.RootChildren()
+	if !hl || hr || l != 5 {
+		t.Fatalf("got left=%v(%v) right present=%v, want left=5 only", l, hl, hr)
+	}
+
+	_ = tr.Insert(15, 3)
+	l, hl, r, hr := tr.RootChildren()
+	if !hl || !hr || l != 5 || r != 15 {
+		t.Fatalf("got left=%v(%v) right=%v(%v), want 5 and 15", l, hl, r, hr)
+	}
+}
+
+func TestKeysByRankRange(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(1))
+	tr, keys := buildRandomTreap(rng, 50)
+
+	cases := []struct{ start, end, wantStart, wantEnd int }{
+		{0, 50, 0, 50},
+		{10, 20, 10, 20},
+		{-5, 3, 0, 3},
+		{45, 100, 45, 50},
+		{30, 30, 0, 0},
+		{40, 10, 0, 0},
+		{60, 70, 0, 0},
+	}
+	for _, c := range cases {
+		got := tr.KeysByRankRange(c.start, c.end)
+		want := keys[c.wantStart:c.wantEnd]
+		if len(got) != len(want) {
+			t.Fatalf("[%d,%d): len=%d, want=%d", c.start, c.end, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("[%d,%d): got %v, want %v", c.start, c.end, got, want)
+			}
+		}
+	}
+}
+
+func equalKeys(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestVersionedTreapUndoRedo(t *testing.T) {
+	t.Parallel()
+
+	v := NewVersionedTreap[int](10)
+	_ = v.Insert(5, 0.5)
+	_ = v.Insert(3, 0.2)
+	_ = v.Insert(8, 0.9)
+	snapshot := v.Keys()
+
+	_ = v.Insert(1, 0.1)
+	if !v.Remove(5) {
+		t.Fatalf("Remove(5) failed")
+	}
+	if v.Remove(42) {
+		t.Fatalf("Remove of absent key reported success")
+	}
+	if got := v.Keys(); !equalKeys(got, []int{1, 3, 8}) {
+		t.Fatalf("Keys=%v, want [1 3 8]", got)
+	}
+
+	if !v.Undo() || !v.Undo() {
+		t.Fatalf("Undo failed")
+	}
+	if got := v.Keys(); !equalKeys(got, snapshot) {
+		t.Fatalf("after undo Keys=%v, want %v", got, snapshot)
+	}
+	if v.Contains(1) || !v.Contains(5) {
+		t.Fatalf("Contains disagrees with restored version")
+	}
+
+	if !v.Redo() {
+		t.Fatalf("Redo failed")
+	}
+	if got := v.Keys(); !equalKeys(got, []int{1, 3, 5, 8}) {
+		t.Fatalf("after redo Keys=%v", got)
+	}
+
+	_ = v.Insert(9, 0.3)
+	if v.Redo() {
+		t.Fatalf("Redo must be unavailable after a new mutation")
+	}
+
+	for v.Undo() {
+	}
+	if got := v.Keys(); len(got) != 0 {
+		t.Fatalf("oldest version Keys=%v, want empty", got)
+	}
+}
+
+func TestVersionedTreapHistoryCap(t *testing.T) {
+	t.Parallel()
+
+	v := NewVersionedTreap[int](3)
+	for i := 0; i < 10; i++ {
+		_ = v.Insert(i, float64(i))
+	}
+	undos := 0
+	for v.Undo() {
+		undos++
+	}
+	if undos != 2 {
+		t.Fatalf("undos=%d, want 2", undos)
+	}
+	if got := v.Keys(); !equalKeys(got, []int{0, 1, 2, 3, 4, 5, 6, 7}) {
+		t.Fatalf("oldest retained Keys=%v", got)
+	}
+}
+
+func TestIsBSTAndIsValid(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(2))
+	tr, _ := buildRandomTreap(rng, 30)
+	if !tr.IsBST() || !tr.IsValid() {
+		t.Fatalf("fresh treap must be valid")
+	}
+	if empty := NewTreap[int](); !empty.IsBST() || !empty.IsValid() {
+		t.Fatalf("empty treap must be valid")
+	}
+
+	heapBroken, _ := buildRandomTreap(rand.New(rand.NewSource(3)), 30)
+	leaf := heapBroken.root
+	for leaf.left != nil || leaf.right != nil {
+		if leaf.left != nil {
+			leaf = leaf.left
+		} else {
+			leaf = leaf.right
+		}
+	}
+	leaf.priority = -1
+	if !heapBroken.IsBST() {
+		t.Fatalf("priority change must not break BST order")
+	}
+	if heapBroken.IsValid() {
+		t.Fatalf("IsValid must detect heap violation")
+	}
+
+	bstBroken, _ := buildRandomTreap(rand.New(rand.NewSource(4)), 30)
+	node := bstBroken.root
+	for node.left != nil {
+		node = node.left
+	}
+	node.key = 1 << 30
+	if bstBroken.IsBST() || bstBroken.IsValid() {
+		t.Fatalf("IsBST and IsValid must detect key order violation")
+	}
+}
+
+func checkParents(t *testing.T, n *Node[int], parent *Node[int]) {
+	t.Helper()
+
+	if n == nil {
+		return
+	}
+	if n.parent != parent {
+		t.Fatalf("node %d has wrong parent", n.key)
+	}
+	checkParents(t, n.left, n)
+	checkParents(t, n.right, n)
+}
+
+func TestBuildFromSortedWiresParents(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(5))
+	for _, n := range []int{0, 1, 2, 10, 500} {
+		keys := make([]int, n)
+		priorities := make([]float64, n)
+		for i := range keys {
+			keys[i] = i * 2
+			priorities[i] = rng.Float64()
+		}
+
+		tr, err := BuildFromSorted(keys, priorities)
+		if err != nil {
+			t.Fatalf("BuildFromSorted: %v", err)
+		}
+		if !tr.IsValid() {
+			t.Fatalf("n=%d: built treap is not valid", n)
+		}
+		checkParents(t, tr.root, nil)
+
+		got := tr.KeysByRankRange(0, n)
+		if !equalKeys(got, keys) {
+			t.Fatalf("n=%d: keys=%v", n, got)
+		}
+
+		if n > 0 {
+			_ = tr.Insert(-1, -1)
+			tr.Remove(keys[n/2])
+			if !tr.IsValid() {
+				t.Fatalf("n=%d: invalid after rotations", n)
+			}
+		}
+	}
+}
+
+func TestBuildFromSortedRejectsBadInput(t *testing.T) {
+	t.Parallel()
+
+	if _, err := BuildFromSorted([]int{1, 3, 2}, []float64{0, 0, 0}); err != ErrNotSorted {
+		t.Fatalf("unsorted: err=%v, want=%v", err, ErrNotSorted)
+	}
+	if _, err := BuildFromSorted([]int{1, 2, 2}, []float64{0, 0, 0}); err != ErrDuplicateKey {
+		t.Fatalf("duplicate keys: err=%v, want ErrDuplicateKey", err)
+	}
+	if _, err := BuildFromSorted([]int{1, 2}, []float64{0}); err != ErrSizeMismatch {
+		t.Fatalf("mismatch: err=%v, want=%v", err, ErrSizeMismatch)
+	}
+}
+
+func TestKthLargest(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(6))
+	tr, keys := buildRandomTreap(rng, 40)
+	for k := 1; k <= len(keys); k++ {
+		got, err := tr.KthLargest(k)
+		if err != nil {
+			t.Fatalf("KthLargest(%d): %v", k, err)
+		}
+		if want := keys[len(keys)-k]; got != want {
+			t.Fatalf("KthLargest(%d)=%d, want=%d", k, got, want)
+		}
+	}
+	for _, k := range []int{0, -1, len(keys) + 1} {
+		if _, err := tr.KthLargest(k); err != ErrOutOfRange {
+			t.Fatalf("KthLargest(%d): err=%v, want=%v", k, err, ErrOutOfRange)
+		}
+	}
+	if _, err := NewTreap[int]().KthLargest(1); err != ErrOutOfRange {
+		t.Fatalf("empty treap: err=%v, want=%v", err, ErrOutOfRange)
+	}
+}
+
+func TestReshufflePrioritiesRebalances(t *testing.T) {
+	t.Parallel()
+
+	const n = 512
+	tr := NewTreap[int]()
+	for i := 0; i < n; i++ {
+		_ = tr.Insert(i, float64(i))
+	}
+	if h := tr.Height(); h != n {
+		t.Fatalf("skewed treap height=%d, want=%d", h, n)
+	}
+	before := tr.KeysByRankRange(0, n)
+
+	tr.ReshufflePriorities(7)
+	if !tr.IsValid() {
+		t.Fatalf("treap invalid after reshuffle")
+	}
+	if got := tr.KeysByRankRange(0, n); !equalKeys(got, before) {
+		t.Fatalf("keyset changed by reshuffle")
+	}
+	if h := tr.Height(); h > 40 {
+		t.Fatalf("height=%d after reshuffle, want O(log n)", h)
+	}
+
+	empty := NewTreap[int]()
+	empty.ReshufflePriorities(1)
+	if empty.root != nil {
+		t.Fatalf("reshuffling an empty treap created nodes")
+	}
+}
+
+func TestDegreeCounts(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTreap[int]()
+	if l, o, tw := tr.DegreeCounts(); l+o+tw != 0 {
+		t.Fatalf("empty treap counts=%d,%d,%d", l, o, tw)
+	}
+
+	//        50
+	//       /  \
+	//     30    70
+	//    /  \     \
+	//  20    40    80
+	//       /
+	//     35
+	for i, k := range []int{50, 30, 70, 20, 40, 80, 35} {
+		_ = tr.Insert(k, float64(i))
+	}
+	leaves, one, two := tr.DegreeCounts()
+	if leaves != 3 || one != 2 || two != 2 {
+		t.Fatalf("counts=(%d,%d,%d), want (3,2,2)", leaves, one, two)
+	}
+}
+
+func TestVerifySplitMergeRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(8))
+	for trial := 0; trial < 50; trial++ {
+		tr, keys := buildRandomTreap(rng, 1+rng.Intn(60))
+		before := tr.String()
+
+		probes := []int{keys[0], keys[len(keys)-1], keys[0] - 1, keys[len(keys)-1] + 1}
+		for i := 0; i < 10; i++ {
+			probes = append(probes, rng.Intn(len(keys)*10+2)-1)
+		}
+		for _, key := range probes {
+			if !tr.VerifySplitMergeRoundTrip(key) {
+				t.Fatalf("trial %d: round trip failed at key %d", trial, key)
+			}
+		}
+		if tr.String() != before || !tr.IsValid() {
+			t.Fatalf("trial %d: treap modified by verification", trial)
+		}
+	}
+
+	if !NewTreap[int]().VerifySplitMergeRoundTrip(0) {
+		t.Fatalf("empty treap round trip failed")
+	}
+}
+
+func TestSplitAndMerge(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(9))
+	for trial := 0; trial < 30; trial++ {
+		tr, keys := buildRandomTreap(rng, 1+rng.Intn(80))
+		cut := rng.Intn(len(keys)*10 + 2)
+		idx := sort.SearchInts(keys, cut)
+
+		left, right := tr.Split(cut)
+		if tr.root != nil {
+			t.Fatalf("Split left the source treap populated")
+		}
+		if !left.IsValid() || !right.IsValid() {
+			t.Fatalf("trial %d: split halves invalid", trial)
+		}
+		if got := left.KeysByRankRange(0, len(keys)); !equalKeys(got, keys[:idx]) {
+			t.Fatalf("trial %d: left=%v, want %v", trial, got, keys[:idx])
+		}
+		if got := right.KeysByRankRange(0, len(keys)); !equalKeys(got, keys[idx:]) {
+			t.Fatalf("trial %d: right=%v, want %v", trial, got, keys[idx:])
+		}
+
+		merged := Merge(left, right)
+		if !merged.IsValid() {
+			t.Fatalf("trial %d: merged treap invalid", trial)
+		}
+		if got := merged.KeysByRankRange(0, len(keys)); !equalKeys(got, keys) {
+			t.Fatalf("trial %d: merged=%v, want %v", trial, got, keys)
+		}
+		if left.root != nil || right.root != nil {
+			t.Fatalf("Merge left inputs populated")
+		}
+	}
+}
+
+func TestKthAndRank(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(10))
+	tr, keys := buildRandomTreap(rng, 200)
+	if !tr.IsValid() {
+		t.Fatalf("treap invalid after inserts")
+	}
+
+	for i := 0; i < 60; i++ {
+		k := keys[rng.Intn(len(keys))]
+		if tr.Remove(k) {
+			idx := sort.SearchInts(keys, k)
+			keys = append(keys[:idx], keys[idx+1:]...)
+		}
+		_ = tr.Update(keys[rng.Intn(len(keys))], rng.Float64())
+	}
+	if !tr.IsValid() {
+		t.Fatalf("treap invalid after removes and updates")
+	}
+
+	for i, want := range keys {
+		got, err := tr.Kth(i + 1)
+		if err != nil || got != want {
+			t.Fatalf("Kth(%d)=%v,%v want %v", i+1, got, err, want)
+		}
+		rank, err := tr.Rank(want)
+		if err != nil || rank != i+1 {
+			t.Fatalf("Rank(%d)=%v,%v want %v", want, rank, err, i+1)
+		}
+	}
+	for _, k := range []int{0, len(keys) + 1} {
+		if _, err := tr.Kth(k); err != ErrOutOfRange {
+			t.Fatalf("Kth(%d): err=%v, want=%v", k, err, ErrOutOfRange)
+		}
+	}
+	if _, err := tr.Rank(-1); err != ErrNotFound {
+		t.Fatalf("Rank(absent): err=%v, want=%v", err, ErrNotFound)
+	}
+	if got := tr.root.Size(); got != len(keys) {
+		t.Fatalf("root size=%d, want=%d", got, len(keys))
+	}
+}
+
+func TestKeysAndInOrder(t *testing.T) {
+	t.Parallel()
+
+	if keys := NewTreap[int]().Keys(); len(keys) != 0 {
+		t.Fatalf("empty treap Keys() = %v", keys)
+	}
+
+	rng := rand.New(rand.NewSource(9))
+	tr, keys := buildRandomTreap(rng, 100)
+	before := tr.String()
+
+	if got := tr.Keys(); !equalKeys(got, keys) {
+		t.Fatalf("Keys() = %v, want %v", got, keys)
+	}
+
+	var visited []int
+	tr.InOrder(func(key int, priority float64) bool {
+		visited = append(visited, key)
+		return len(visited) < 10
+	})
+	if !equalKeys(visited, keys[:10]) {
+		t.Fatalf("InOrder stopped early with %v, want %v", visited, keys[:10])
+	}
+
+	if tr.String() != before || !tr.IsValid() {
+		t.Fatalf("traversal modified the treap")
+	}
+}
+
+func TestTopLevels(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTreap[int]()
+	for _, kp := range []struct {
+		key      int
+		priority float64
+	}{{50, 1}, {30, 2}, {70, 3}, {20, 4}, {40, 5}, {60, 6}, {80, 7}} {
+		_ = tr.Insert(kp.key, kp.priority)
+	}
+
+	got := tr.TopLevels(2)
+	if len(got) != 2 || !equalKeys(got[0], []int{50}) || !equalKeys(got[1], []int{30, 70}) {
+		t.Fatalf("TopLevels(2) = %v, want [[50] [30 70]]", got)
+	}
+
+	if got := tr.TopLevels(10); len(got) != 3 || !equalKeys(got[2], []int{20, 40, 60, 80}) {
+		t.Fatalf("TopLevels(10) = %v, want three levels ending with [20 40 60 80]", got)
+	}
+	if got := tr.TopLevels(0); len(got) != 0 {
+		t.Fatalf("TopLevels(0) = %v, want empty", got)
+	}
+	if got := NewTreap[int]().TopLevels(3); len(got) != 0 {
+		t.Fatalf("empty treap TopLevels = %v, want empty", got)
+	}
+}
+
+func TestSuccessorAndPredecessor(t *testing.T) {
+	t.Parallel()
+
+	if _, ok := NewTreap[int]().Successor(1); ok {
+		t.Fatalf("Successor on empty treap reported a key")
+	}
+
+	rng := rand.New(rand.NewSource(17))
+	tr := NewTreap[int]()
+	for _, k := range []int{10, 20, 30, 40, 50} {
+		_ = tr.Insert(k, rng.Float64())
+	}
+
+	cases := []struct {
+		key              int
+		succ, pred       int
+		hasSucc, hasPred bool
+	}{
+		{30, 40, 20, true, true},
+		{10, 20, 0, true, false},
+		{50, 0, 40, false, true},
+		{25, 30, 20, true, true},
+		{5, 10, 0, true, false},
+		{55, 0, 50, false, true},
+	}
+	for _, c := range cases {
+		succ, ok := tr.Successor(c.key)
+		if ok != c.hasSucc || (ok && succ != c.succ) {
+			t.Fatalf("Successor(%d) = %d,%v, want %d,%v", c.key, succ, ok, c.succ, c.hasSucc)
+		}
+		pred, ok := tr.Predecessor(c.key)
+		if ok != c.hasPred || (ok && pred != c.pred) {
+			t.Fatalf("Predecessor(%d) = %d,%v, want %d,%v", c.key, pred, ok, c.pred, c.hasPred)
+		}
+	}
+
+	big, keys := buildRandomTreap(rng, 200)
+	for i := 0; i+1 < len(keys); i++ {
+		if got, ok := big.Successor(keys[i]); !ok || got != keys[i+1] {
+			t.Fatalf("Successor(%d) = %d,%v, want %d", keys[i], got, ok, keys[i+1])
+		}
+		if got, ok := big.Predecessor(keys[i+1]); !ok || got != keys[i] {
+			t.Fatalf("Predecessor(%d) = %d,%v, want %d", keys[i+1], got, ok, keys[i])
+		}
+	}
+}
+
+func TestFloorAndCeiling(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTreap[int]()
+	if _, ok := tr.Floor(1); ok {
+		t.Fatalf("Floor on empty treap reported a key")
+	}
+
+	rng := rand.New(rand.NewSource(23))
+	for _, k := range []int{100, 200, 300, 400} {
+		_ = tr.Insert(k, rng.Float64())
+	}
+
+	cases := []struct {
+		key               int
+		floor, ceil       int
+		hasFloor, hasCeil bool
+	}{
+		{250, 200, 300, true, true},
+		{200, 200, 200, true, true},
+		{50, 0, 100, false, true},
+		{100, 100, 100, true, true},
+		{450, 400, 0, true, false},
+		{400, 400, 400, true, true},
+	}
+	for _, c := range cases {
+		f, ok := tr.Floor(c.key)
+		if ok != c.hasFloor || (ok && f != c.floor) {
+			t.Fatalf("Floor(%d) = %d,%v, want %d,%v", c.key, f, ok, c.floor, c.hasFloor)
+		}
+		ce, ok := tr.Ceiling(c.key)
+		if ok != c.hasCeil || (ok && ce != c.ceil) {
+			t.Fatalf("Ceiling(%d) = %d,%v, want %d,%v", c.key, ce, ok, c.ceil, c.hasCeil)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTreap[int]()
+	if tr.Contains(1) {
+		t.Fatalf("empty treap contains 1")
+	}
+
+	_ = tr.Insert(20, 0.5)
+	_ = tr.Insert(10, 0.7)
+	_ = tr.Insert(30, 0.9)
+	for _, k := range []int{10, 20, 30} {
+		if !tr.Contains(k) {
+			t.Fatalf("Contains(%d) = false", k)
+		}
+	}
+	for _, k := range []int{5, 15, 25, 35} {
+		if tr.Contains(k) {
+			t.Fatalf("Contains(%d) = true for absent key", k)
+		}
+	}
+}
+
+func TestIsAncestor(t *testing.T) {
+	t.Parallel()
+
+	// 50
+	// ├── 30
+	// │   ├── 20
+	// │   └── 40
+	// └── 70
+	//     └── 60
+	tr := NewTreap[int]()
+	for _, kp := range []struct {
+		key      int
+		priority float64
+	}{{50, 1}, {30, 2}, {70, 3}, {20, 4}, {40, 5}, {60, 6}} {
+		_ = tr.Insert(kp.key, kp.priority)
+	}
+
+	cases := []struct {
+		ancestor, descendant int
+		want                 bool
+	}{
+		{50, 20, true},
+		{50, 60, true},
+		{30, 40, true},
+		{70, 60, true},
+		{30, 60, false},
+		{20, 30, false},
+		{40, 20, false},
+		{50, 50, false},
+		{99, 20, false},
+		{50, 99, false},
+	}
+	for _, c := range cases {
+		if got := tr.IsAncestor(c.ancestor, c.descendant); got != c.want {
+			t.Fatalf("IsAncestor(%d, %d) = %v, want %v", c.ancestor, c.descendant, got, c.want)
+		}
+	}
+}
+
+func TestSizeAndHeight(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTreap[int]()
+	if tr.Size() != 0 || tr.Height() != 0 {
+		t.Fatalf("empty treap: Size=%d Height=%d", tr.Size(), tr.Height())
+	}
+
+	// 50 -> (30 -> 20, 40 -> 45), 70
+	for _, kp := range []struct {
+		key      int
+		priority float64
+	}{{50, 1}, {30, 2}, {70, 3}, {20, 4}, {40, 5}, {45, 6}} {
+		_ = tr.Insert(kp.key, kp.priority)
+	}
+	if tr.Size() != 6 || tr.Height() != 4 {
+		t.Fatalf("Size=%d Height=%d, want 6 and 4", tr.Size(), tr.Height())
+	}
+
+	tr.Remove(45)
+	tr.Remove(70)
+	if tr.Size() != 4 || tr.Height() != 3 {
+		t.Fatalf("after removals Size=%d Height=%d, want 4 and 3", tr.Size(), tr.Height())
+	}
+}
+
+func TestInsertKeyStaysBalanced(t *testing.T) {
+	t.Parallel()
+
+	const n = 10000
+	tr := NewTreapWithSeed[int](42)
+	for i := 0; i < n; i++ {
+		tr.InsertKey(i)
+	}
+	if !tr.IsValid() || tr.Size() != n {
+		t.Fatalf("invalid treap after InsertKey: valid=%v size=%d", tr.IsValid(), tr.Size())
+	}
+	// Expected height is about 2.99*log2(n) ≈ 40 for random priorities.
+	if h := tr.Height(); h > 60 {
+		t.Fatalf("Height=%d for %d sorted inserts, want O(log n)", h, n)
+	}
+
+	again := NewTreapWithSeed[int](42)
+	for i := 0; i < n; i++ {
+		again.InsertKey(i)
+	}
+	if again.String() != tr.String() {
+		t.Fatalf("same seed produced different shapes")
+	}
+}
+
+func TestRangeKeysAndRangeCount(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(29))
+	tr, keys := buildRandomTreap(rng, 300)
+
+	inRange := func(lo, hi int) []int {
+		want := make([]int, 0)
+		for _, k := range keys {
+			if lo <= k && k <= hi {
+				want = append(want, k)
+			}
+		}
+		return want
+	}
+
+	cases := []struct{ lo, hi int }{
+		{keys[0], keys[len(keys)-1]},
+		{-100, 100000},
+		{keys[10], keys[40]},
+		{keys[10] + 1, keys[40] - 1},
+		{-10, -1},
+		{100000, 200000},
+		{keys[50], keys[20]},
+		{keys[7], keys[7]},
+	}
+	for _, c := range cases {
+		want := inRange(c.lo, c.hi)
+		if got := tr.RangeKeys(c.lo, c.hi); !equalKeys(got, want) {
+			t.Fatalf("RangeKeys(%d, %d) = %v, want %v", c.lo, c.hi, got, want)
+		}
+		if got := tr.RangeCount(c.lo, c.hi); got != len(want) {
+			t.Fatalf("RangeCount(%d, %d) = %d, want %d", c.lo, c.hi, got, len(want))
+		}
+	}
+}
+
+func TestRemoveKeepsTreapValid(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(31))
+	for round := 0; round < 20; round++ {
+		tr := NewTreap[int]()
+		keys := make([]int, 0)
+		for i := 0; i < 200; i++ {
+			k := rng.Intn(400)
+			if tr.Insert(k, float64(rng.Intn(10))) == nil {
+				keys = append(keys, k)
+			}
+		}
+
+		rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+		for i, k := range keys {
+			if !tr.Remove(k) {
+				t.Fatalf("round %d: Remove(%d) = false", round, k)
+			}
+			if !tr.IsValid() {
+				t.Fatalf("round %d: invalid treap after removing %d:\n%s", round, k, tr)
+			}
+			if tr.Size() != len(keys)-i-1 {
+				t.Fatalf("round %d: Size=%d, want %d", round, tr.Size(), len(keys)-i-1)
+			}
+		}
+		if tr.Remove(0) {
+			t.Fatalf("round %d: Remove on empty treap = true", round)
+		}
+	}
+}
+
+func TestClear(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(37))
+	tr, _ := buildRandomTreap(rng, 50)
+	tr.Clear()
+
+	if tr.Size() != 0 || tr.Height() != 0 || len(tr.Keys()) != 0 {
+		t.Fatalf("cleared treap: Size=%d Height=%d Keys=%v", tr.Size(), tr.Height(), tr.Keys())
+	}
+	if _, err := tr.Peek(); err != ErrNilNode {
+		t.Fatalf("Peek err=%v, want ErrNilNode", err)
+	}
+	if _, err := tr.Top(); err != ErrNilNode {
+		t.Fatalf("Top err=%v, want ErrNilNode", err)
+	}
+	if _, err := tr.Min(); err != ErrNilNode {
+		t.Fatalf("Min err=%v, want ErrNilNode", err)
+	}
+	if _, err := tr.Max(); err != ErrNilNode {
+		t.Fatalf("Max err=%v, want ErrNilNode", err)
+	}
+
+	_ = tr.Insert(3, 0.3)
+	_ = tr.Insert(1, 0.1)
+	if !tr.IsValid() || !equalKeys(tr.Keys(), []int{1, 3}) {
+		t.Fatalf("reused treap: valid=%v keys=%v", tr.IsValid(), tr.Keys())
+	}
+}
+
+func TestCloneIsIndependent(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(41))
+	tr, keys := buildRandomTreap(rng, 100)
+	before := tr.String()
+
+	c := tr.Clone()
+	if c.String() != before || !c.IsValid() {
+		t.Fatalf("clone differs from source or is invalid")
+	}
+	checkParents(t, c.root, nil)
+
+	for i, k := range keys {
+		switch i % 3 {
+		case 0:
+			c.Remove(k)
+		case 1:
+			_ = c.Update(k, rng.Float64())
+		default:
+			_ = c.Insert(k+100000, rng.Float64())
+		}
+	}
+	if !c.IsValid() {
+		t.Fatalf("mutated clone is invalid")
+	}
+
+	if !equalKeys(tr.Keys(), keys) || tr.String() != before || !tr.IsValid() {
+		t.Fatalf("mutating the clone changed the source")
+	}
+}
+
+func TestCloneKeepsSourceGenerator(t *testing.T) {
+	t.Parallel()
+
+	a := NewTreapWithSeed[int](42)
+	b := NewTreapWithSeed[int](42)
+	for i := 0; i < 50; i++ {
+		a.InsertKey(i)
+		b.InsertKey(i)
+	}
+
+	clones := make(chan *Treap[int], 4)
+	for i := 0; i < cap(clones); i++ {
+		go func() { clones <- a.Clone() }()
+	}
+	for i := 0; i < cap(clones); i++ {
+		if c := <-clones; c.String() != a.String() {
+			t.Fatalf("clone differs from source")
+		}
+	}
+
+	for i := 50; i < 100; i++ {
+		a.InsertKey(i)
+		b.InsertKey(i)
+	}
+	if a.String() != b.String() {
+		t.Fatalf("Clone advanced the source's priority generator")
+	}
+}
+
+func TestCloneDoesNotReplayPriorities(t *testing.T) {
+	t.Parallel()
+
+	keys := []int{1, 2, 3, 4, 5}
+	src, err := BuildSortedTreap(keys, 43)
+	if err != nil {
+		t.Fatalf("BuildSortedTreap: %v", err)
+	}
+	used := make(map[float64]bool)
+	src.root.inOrder(func(n *Node[int]) bool {
+		used[n.priority] = true
+		return true
+	})
+
+	c1, c2 := src.Clone(), src.Clone()
+	c1.InsertKey(100)
+	c2.InsertKey(100)
+	p := c1.root.Search(100).priority
+	if used[p] {
+		t.Fatalf("clone reused priority %v already handed out by the source", p)
+	}
+	if c2.root.Search(100).priority != p {
+		t.Fatalf("clones taken at the same point drew different priorities")
+	}
+}
+
+func TestBuildSortedTreapMatchesInsertion(t *testing.T) {
+	t.Parallel()
+
+	keys := make([]int, 1000)
+	for i := range keys {
+		keys[i] = i * 3
+	}
+
+	built, err := BuildSortedTreap(keys, 43)
+	if err != nil {
+		t.Fatalf("BuildSortedTreap: %v", err)
+	}
+	incremental := NewTreapWithSeed[int](43)
+	for _, k := range keys {
+		incremental.InsertKey(k)
+	}
+
+	if !built.IsValid() || !equalKeys(built.Keys(), incremental.Keys()) {
+		t.Fatalf("built treap: valid=%v, keys differ from incremental insertion", built.IsValid())
+	}
+	checkParents(t, built.root, nil)
+	// Same keys and priorities determine the treap uniquely.
+	if built.String() != incremental.String() {
+		t.Fatalf("built treap shape differs from incremental insertion")
+	}
+
+	if _, err := BuildSortedTreap([]int{1, 3, 2}, 1); err != ErrNotSorted {
+		t.Fatalf("unsorted input: err=%v, want ErrNotSorted", err)
+	}
+	if empty, err := BuildSortedTreap[int](nil, 1); err != nil || empty.Size() != 0 {
+		t.Fatalf("empty input: err=%v size=%d", err, empty.Size())
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(47))
+	for round := 0; round < 30; round++ {
+		a, aKeys := buildRandomTreap(rng, 1+rng.Intn(200))
+		b, bKeys := buildRandomTreap(rng, 1+rng.Intn(200))
+		aBefore, bBefore := a.String(), b.String()
+
+		inA := make(map[int]bool)
+		for _, k := range aKeys {
+			inA[k] = true
+		}
+		inB := make(map[int]bool)
+		for _, k := range bKeys {
+			inB[k] = true
+		}
+		var wantUnion, wantInter, wantDiff []int
+		for k := range inA {
+			if inB[k] {
+				wantInter = append(wantInter, k)
+			} else {
+				wantDiff = append(wantDiff, k)
+			}
+			wantUnion = append(wantUnion, k)
+		}
+		for k := range inB {
+			if !inA[k] {
+				wantUnion = append(wantUnion, k)
+			}
+		}
+		sort.Ints(wantUnion)
+		sort.Ints(wantInter)
+		sort.Ints(wantDiff)
+
+		for name, c := range map[string]struct {
+			got  *Treap[int]
+			want []int
+		}{
+			"Union":        {a.Union(b), wantUnion},
+			"Intersection": {a.Intersection(b), wantInter},
+			"Difference":   {a.Difference(b), wantDiff},
+		} {
+			if !c.got.IsValid() {
+				t.Fatalf("round %d: %s result is not a valid treap", round, name)
+			}
+			checkParents(t, c.got.root, nil)
+			if got := c.got.Keys(); !equalKeys(got, c.want) {
+				t.Fatalf("round %d: %s = %v, want %v", round, name, got, c.want)
+			}
+		}
+
+		if a.String() != aBefore || b.String() != bBefore {
+			t.Fatalf("round %d: set operation modified an input", round)
+		}
+	}
+}
+
+func TestUnionKeepsSmallerPriority(t *testing.T) {
+	t.Parallel()
+
+	a := NewTreap[int]()
+	_ = a.Insert(1, 0.9)
+	_ = a.Insert(2, 0.2)
+	b := NewTreap[int]()
+	_ = b.Insert(1, 0.1)
+	_ = b.Insert(2, 0.8)
+
+	for _, u := range []*Treap[int]{a.Union(b), b.Union(a), a.Intersection(b)} {
+		if p := u.root.Search(1).priority; p != 0.1 {
+			t.Fatalf("key 1 priority=%v, want 0.1", p)
+		}
+		if p := u.root.Search(2).priority; p != 0.2 {
+			t.Fatalf("key 2 priority=%v, want 0.2", p)
+		}
+	}
+}
+
+func TestPriorityOf(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTreap[string]()
+	if _, err := tr.PriorityOf("a"); err != ErrNotFound {
+		t.Fatalf("empty treap: err=%v, want ErrNotFound", err)
+	}
+
+	_ = tr.Insert("b", 0.5)
+	_ = tr.Insert("a", 0.25)
+	_ = tr.Insert("c", 0.75)
+	if p, err := tr.PriorityOf("c"); err != nil || p != 0.75 {
+		t.Fatalf("PriorityOf(c) = %v,%v, want 0.75", p, err)
+	}
+
+	_ = tr.Update("c", 0.1)
+	if p, err := tr.PriorityOf("c"); err != nil || p != 0.1 {
+		t.Fatalf("after Update PriorityOf(c) = %v,%v, want 0.1", p, err)
+	}
+	if _, err := tr.PriorityOf("z"); err != ErrNotFound {
+		t.Fatalf("PriorityOf(z) err=%v, want ErrNotFound", err)
+	}
+}
+
+func TestDuplicateKeysAreRejected(t *testing.T) {
+	t.Parallel()
+
+	tr := NewTreap[int]()
+	_ = tr.Insert(10, 0.5)
+	_ = tr.Insert(20, 0.6)
+	before := tr.String()
+
+	if err := tr.Insert(10, 0.1); err != ErrDuplicateKey {
+		t.Fatalf("Insert of existing key: err=%v, want ErrDuplicateKey", err)
+	}
+	if tr.String() != before || tr.Size() != 2 {
+		t.Fatalf("rejected Insert modified the treap")
+	}
+	if p, _ := tr.PriorityOf(10); p != 0.5 {
+		t.Fatalf("Search finds priority %v, want the original 0.5", p)
+	}
+
+	tr.InsertKey(20)
+	if tr.Size() != 2 {
+		t.Fatalf("InsertKey stored a duplicate: Size=%d", tr.Size())
+	}
+
+	if !tr.Remove(10) || tr.Contains(10) || tr.Remove(10) {
+		t.Fatalf("a single Remove must delete the only copy of the key")
+	}
+	if err := tr.Insert(10, 0.1); err != nil {
+		t.Fatalf("re-Insert after Remove: %v", err)
+	}
+
+	v := NewVersionedTreap[int](4)
+	_ = v.Insert(1, 0.5)
+	if err := v.Insert(1, 0.2); err != ErrDuplicateKey {
+		t.Fatalf("VersionedTreap Insert of existing key: err=%v, want ErrDuplicateKey", err)
+	}
+	if !v.Undo() || v.Undo() {
+		t.Fatalf("rejected VersionedTreap Insert recorded a version")
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(53))
+	tr, keys := buildRandomTreap(rng, 200)
+
+	data, err := json.Marshal(tr)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	restored := NewTreap[int]()
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if restored.String() != tr.String() || !equalKeys(restored.Keys(), keys) {
+		t.Fatalf("round trip changed the treap")
+	}
+	checkParents(t, restored.root, nil)
+	if !restored.IsValid() {
+		t.Fatalf("restored treap is invalid")
+	}
+
+	empty := NewTreap[int]()
+	data, _ = json.Marshal(empty)
+	if string(data) != "null" {
+		t.Fatalf("empty treap encodes as %s, want null", data)
+	}
+	if err := json.Unmarshal(data, restored); err != nil || restored.Size() != 0 {
+		t.Fatalf("decoding null: err=%v size=%d", err, restored.Size())
+	}
+
+	bad := `{"key":5,"priority":0.5,"left":{"key":9,"priority":0.7}}`
+	if err := json.Unmarshal([]byte(bad), tr); !errors.Is(err, ErrInvalidTreap) {
+		t.Fatalf("out-of-order keys: err=%v, want ErrInvalidTreap", err)
+	}
+	if !equalKeys(tr.Keys(), keys) {
+		t.Fatalf("failed Unmarshal modified the treap")
+	}
+}
+
+func TestValidateReportsViolations(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(59))
+	tr, _ := buildRandomTreap(rng, 100)
+	if err := tr.Validate(); err != nil {
+		t.Fatalf("fresh treap: %v", err)
+	}
+
+	heap := tr.Clone()
+	leaf := heap.root
+	for leaf.left != nil || leaf.right != nil {
+		if leaf.right != nil {
+			leaf = leaf.right
+		} else {
+			leaf = leaf.left
+		}
+	}
+	leaf.priority = leaf.parent.priority - 1
+	if err := heap.Validate(); !errors.Is(err, ErrInvalidTreap) || !strings.Contains(err.Error(), "priority") {
+		t.Fatalf("corrupted priority: err=%v", err)
+	}
+
+	order := tr.Clone()
+	order.root.left.key, order.root.right.key = order.root.right.key, order.root.left.key
+	if err := order.Validate(); !errors.Is(err, ErrInvalidTreap) || !strings.Contains(err.Error(), "follows") {
+		t.Fatalf("swapped keys: err=%v", err)
+	}
+
+	parents := tr.Clone()
+	parents.root.left.parent = nil
+	if err := parents.Validate(); !errors.Is(err, ErrInvalidTreap) || !strings.Contains(err.Error(), "parent") {
+		t.Fatalf("broken parent pointer: err=%v", err)
+	}
+
+	if err := tr.Validate(); err != nil {
+		t.Fatalf("corrupting clones changed the source: %v", err)
+	}
+}
+
+func TestImplicitTreapMatchesSlice(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewSource(71))
+	it := NewImplicitTreap[int](71)
+	ref := make([]int, 0)
+
+	for step := 0; step < 3000; step++ {
+		switch op := rng.Intn(10); {
+		case op < 5 || len(ref) == 0:
+			i := rng.Intn(len(ref) + 1)
+			v := rng.Intn(1000)
+			if err := it.InsertAt(i, v); err != nil {
+				t.Fatalf("step %d: InsertAt(%d): %v", step, i, err)
+			}
+			ref = append(ref[:i], append([]int{v}, ref[i:]...)...)
+		case op < 8:
+			i := rng.Intn(len(ref))
+			got, err := it.RemoveAt(i)
+			if err != nil || got != ref[i] {
+				t.Fatalf("step %d: RemoveAt(%d) = %d,%v, want %d", step, i, got, err, ref[i])
+			}
+			ref = append(ref[:i], ref[i+1:]...)
+		default:
+			i := rng.Intn(len(ref))
+			if got, err := it.Get(i); err != nil || got != ref[i] {
+				t.Fatalf("step %d: Get(%d) = %d,%v, want %d", step, i, got, err, ref[i])
+			}
+		}
+
+		if it.Len() != len(ref) {
+			t.Fatalf("step %d: Len=%d, want %d", step, it.Len(), len(ref))
+		}
+	}
+
+	if !equalKeys(it.Values(), ref) {
+		t.Fatalf("Values() = %v, want %v", it.Values(), ref)
+	}
+	var checkShape func(n *implicitNode[int]) int
+	checkShape = func(n *implicitNode[int]) int {
+		if n == nil {
+			return 0
+		}
+		for _, c := range []*implicitNode[int]{n.left, n.right} {
+			if c != nil && c.priority < n.priority {
+				t.Fatalf("heap order violated below value %d", n.value)
+			}
+		}
+		if size := 1 + checkShape(n.left) + checkShape(n.right); size != n.size {
+			t.Fatalf("node size=%d, want %d", n.size, size)
+		}
+		return n.size
+	}
+	checkShape(it.root)
+
+	if err := it.InsertAt(-1, 0); err != ErrOutOfRange {
+		t.Fatalf("InsertAt(-1): err=%v", err)
+	}
+	if err := it.InsertAt(it.Len()+1, 0); err != ErrOutOfRange {
+		t.Fatalf("InsertAt past end: err=%v", err)
+	}
+	if _, err := it.RemoveAt(it.Len()); err != ErrOutOfRange {
+		t.Fatalf("RemoveAt(Len): err=%v", err)
+	}
+	if _, err := it.Get(-1); err != ErrOutOfRange {
+		t.Fatalf("Get(-1): err=%v", err)
+	}
+}
+
+func TestImplicitTreapZeroValue(t *testing.T) {
+	t.Parallel()
+
+	var it ImplicitTreap[int]
+	for i := 0; i < 10; i++ {
+		if err := it.InsertAt(0, i); err != nil {
+			t.Fatalf("InsertAt on zero value: %v", err)
+		}
+	}
+	if !equalKeys(it.Values(), []int{9, 8, 7, 6, 5, 4, 3, 2, 1, 0}) {
+		t.Fatalf("Values() = %v", it.Values())
+	}
+}
+
+func TestImplicitTreapHoldsUnorderedValues(t *testing.T) {
+	t.Parallel()
+
+	it := NewImplicitTreap[[]string](73)
+	_ = it.InsertAt(0, []string{"b"})
+	_ = it.InsertAt(0, []string{"a"})
+	_ = it.InsertAt(2, []string{"c", "d"})
+	if got, err := it.Get(2); err != nil || len(got) != 2 || got[1] != "d" {
+		t.Fatalf("Get(2) = %v,%v, want [c d]", got, err)
+	}
+	if got, err := it.RemoveAt(0); err != nil || got[0] != "a" {
+		t.Fatalf("RemoveAt(0) = %v,%v, want [a]", got, err)
+	}
+	if it.Len() != 2 {
+		t.Fatalf("Len=%d, want 2", it.Len())
+	}
+}
@@ -0,0 +1,163 @@
+package treap
+
+import (
+	"golang.org/x/exp/constraints"
+)
+
+// VersionedTreap keeps a bounded history of treap versions. Nodes are never
+// mutated once built, so every version shares all untouched subtrees with
+// its neighbours and a mutation costs O(log n) new nodes.
+type VersionedTreap[T constraints.Ordered] struct {
+	versions    []*persistentNode[T]
+	current     int
+	maxVersions int
+}
+
+type persistentNode[T constraints.Ordered] struct {
+	key      T
+	priority float64
+	left     *persistentNode[T]
+	right    *persistentNode[T]
+}
+
+func NewVersionedTreap[T constraints.Ordered](maxVersions int) *VersionedTreap[T] {
+	if maxVersions < 1 {
+		maxVersions = 1
+	}
+	return &VersionedTreap[T]{
+		versions:    []*persistentNode[T]{nil},
+		maxVersions: maxVersions,
+	}
+}
+
+// Insert adds key as a new version. A key that is already present returns
+// ErrDuplicateKey without recording a version.
+func (v *VersionedTreap[T]) Insert(key T, priority float64) error {
+	if v.Contains(key) {
+		return ErrDuplicateKey
+	}
+	left, right := persistentSplit(v.root(), key)
+	node := &persistentNode[T]{key: key, priority: priority}
+	v.push(persistentMerge(persistentMerge(left, node), right))
+	return nil
+}
+
+func (v *VersionedTreap[T]) Remove(key T) bool {
+	root, ok := persistentRemove(v.root(), key)
+	if !ok {
+		return false
+	}
+	v.push(root)
+	return true
+}
+
+func (v *VersionedTreap[T]) Undo() bool {
+	if v.current == 0 {
+		return false
+	}
+	v.current--
+	return true
+}
+
+func (v *VersionedTreap[T]) Redo() bool {
+	if v.current == len(v.versions)-1 {
+		return false
+	}
+	v.current++
+	return true
+}
+
+func (v *VersionedTreap[T]) Contains(key T) bool {
+	node := v.root()
+	for node != nil {
+		if key == node.key {
+			return true
+		}
+		if key < node.key {
+			node = node.left
+		} else {
+			node = node.right
+		}
+	}
+	return false
+}
+
+func (v *VersionedTreap[T]) Keys() []T {
+	keys := make([]T, 0)
+	var walk func(n *persistentNode[T])
+	walk = func(n *persistentNode[T]) {
+		if n == nil {
+			return
+		}
+		walk(n.left)
+		keys = append(keys, n.key)
+		walk(n.right)
+	}
+	walk(v.root())
+	return keys
+}
+
+func (v *VersionedTreap[T]) root() *persistentNode[T] {
+	return v.versions[v.current]
+}
+
+func (v *VersionedTreap[T]) push(root *persistentNode[T]) {
+	v.versions = append(v.versions[:v.current+1], root)
+	if len(v.versions) > v.maxVersions {
+		v.versions = v.versions[len(v.versions)-v.maxVersions:]
+	}
+	v.current = len(v.versions) - 1
+}
+
+func persistentSplit[T constraints.Ordered](n *persistentNode[T], key T) (*persistentNode[T], *persistentNode[T]) {
+	if n == nil {
+		return nil, nil
+	}
+	c := *n
+	if n.key < key {
+		var right *persistentNode[T]
+		c.right, right = persistentSplit(n.right, key)
+		return &c, right
+	}
+	var left *persistentNode[T]
+	left, c.left = persistentSplit(n.left, key)
+	return left, &c
+}
+
+func persistentMerge[T constraints.Ordered](left, right *persistentNode[T]) *persistentNode[T] {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	if left.priority <= right.priority {
+		c := *left
+		c.right = persistentMerge(left.right, right)
+		return &c
+	}
+	c := *right
+	c.left = persistentMerge(left, right.left)
+	return &c
+}
+
+func persistentRemove[T constraints.Ordered](n *persistentNode[T], key T) (*persistentNode[T], bool) {
+	if n == nil {
+		return nil, false
+	}
+	if key == n.key {
+		return persistentMerge(n.left, n.right), true
+	}
+
+	c := *n
+	var ok bool
+	if key < n.key {
+		c.left, ok = persistentRemove(n.left, key)
+	} else {
+		c.right, ok = persistentRemove(n.right, key)
+	}
+	if !ok {
+		return n, false
+	}
+	return &c, true
+}